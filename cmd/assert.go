@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const testsPlaceholder = `
+	write Tests as a list of assertions
+
+[
+	{"status": "2xx"},
+	{"header": "Content-Type", "matches": "json"},
+	{"jsonPath": "$.data.id", "equals": 42},
+	{"jsonPath": "$.data.tags", "contains": "new"},
+	{"jsonPath": "$.token"},
+	{"bodyMatches": "\"ok\":\\s*true"},
+	{"maxTime": "500ms"}
+]`
+
+// Assertion is a single test run against a response. Exactly one of Status,
+// Header, JSONPath, BodyMatches or MaxTime picks what is checked; Equals,
+// Contains, Matches and Exists say how headers and JSON values are checked.
+// Without one of those a header or JSON value only has to exist.
+type Assertion struct {
+	Status      string          `json:"status,omitempty"`
+	Header      string          `json:"header,omitempty"`
+	JSONPath    string          `json:"jsonPath,omitempty"`
+	BodyMatches string          `json:"bodyMatches,omitempty"`
+	MaxTime     string          `json:"maxTime,omitempty"`
+	Equals      json.RawMessage `json:"equals,omitempty"`
+	Contains    json.RawMessage `json:"contains,omitempty"`
+	Matches     string          `json:"matches,omitempty"`
+	Exists      *bool           `json:"exists,omitempty"`
+}
+
+// UnmarshalJSON reads an assertion, taking its status as a number such as
+// 200 as well as text such as "2xx".
+func (a *Assertion) UnmarshalJSON(data []byte) error {
+	type plain Assertion
+	var raw struct {
+		plain
+		Status json.RawMessage `json:"status,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*a = Assertion(raw.plain)
+	if raw.Status == nil || string(raw.Status) == "null" {
+		return nil
+	}
+	var code int
+	if err := json.Unmarshal(raw.Status, &code); err == nil {
+		a.Status = strconv.Itoa(code)
+		return nil
+	}
+	if err := json.Unmarshal(raw.Status, &a.Status); err != nil {
+		return fmt.Errorf("status takes a code, class or range such as 200, 2xx or 200-299")
+	}
+	return nil
+}
+
+// assertionResult is the outcome of one Assertion.
+type assertionResult struct {
+	name    string
+	passed  bool
+	message string
+}
+
+// parseAssertions parses the raw JSON of a Tests tab. An empty string yields
+// no assertions.
+func parseAssertions(raw string) ([]Assertion, error) {
+	var assertions []Assertion
+	if strings.TrimSpace(raw) == "" {
+		return assertions, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &assertions); err != nil {
+		return nil, err
+	}
+	for i, a := range assertions {
+		if err := a.validate(); err != nil {
+			return nil, fmt.Errorf("test %d: %w", i+1, err)
+		}
+	}
+	return assertions, nil
+}
+
+func (a Assertion) validate() error {
+	subjects := 0
+	for _, s := range []string{a.Status, a.Header, a.JSONPath, a.BodyMatches, a.MaxTime} {
+		if s != "" {
+			subjects++
+		}
+	}
+	if subjects != 1 {
+		return fmt.Errorf("set exactly one of status, header, jsonPath, bodyMatches or maxTime")
+	}
+
+	checks := 0
+	for _, set := range []bool{a.Equals != nil, a.Contains != nil, a.Matches != "", a.Exists != nil} {
+		if set {
+			checks++
+		}
+	}
+	if checks > 1 {
+		return fmt.Errorf("use only one of equals, contains, matches or exists")
+	}
+
+	switch {
+	case a.Status != "":
+		if checks > 0 {
+			return fmt.Errorf("status takes a code, class or range such as 200, 2xx or 200-299")
+		}
+		if _, err := parseStatusRanges(a.Status); err != nil {
+			return err
+		}
+	case a.MaxTime != "":
+		if checks > 0 {
+			return fmt.Errorf("maxTime takes a duration such as 500ms")
+		}
+		if _, err := parseDuration(a.MaxTime); err != nil {
+			return fmt.Errorf("maxTime: %w", err)
+		}
+	case a.BodyMatches != "":
+		if checks > 0 {
+			return fmt.Errorf("bodyMatches takes a regular expression")
+		}
+		if _, err := regexp.Compile(a.BodyMatches); err != nil {
+			return fmt.Errorf("bodyMatches: %w", err)
+		}
+	case a.JSONPath != "":
+		if _, err := parseJSONPath(a.JSONPath); err != nil {
+			return err
+		}
+	}
+
+	if a.Matches != "" {
+		if _, err := regexp.Compile(a.Matches); err != nil {
+			return fmt.Errorf("matches: %w", err)
+		}
+	}
+	if a.Header != "" && a.Contains != nil {
+		var s string
+		if json.Unmarshal(a.Contains, &s) != nil {
+			return fmt.Errorf("header contains takes a string")
+		}
+	}
+	return nil
+}
+
+// checkAssertions evaluates every assertion against a response.
+func checkAssertions(assertions []Assertion, res result) []assertionResult {
+	results := make([]assertionResult, 0, len(assertions))
+	for _, a := range assertions {
+		results = append(results, a.check(res))
+	}
+	return results
+}
+
+func (a Assertion) check(res result) assertionResult {
+	switch {
+	case a.Status != "":
+		ranges, _ := parseStatusRanges(a.Status)
+		r := assertionResult{name: "status is " + a.Status, passed: matchStatus(ranges, res.statusCode)}
+		if !r.passed {
+			r.message = "got " + res.status
+		}
+		return r
+
+	case a.MaxTime != "":
+		limit, _ := parseDuration(a.MaxTime)
+		r := assertionResult{name: "response time under " + a.MaxTime}
+		if res.timings == nil {
+			r.message = "no timing recorded"
+			return r
+		}
+		r.passed = res.timings.Total <= limit
+		if !r.passed {
+			r.message = "took " + formatDuration(res.timings.Total)
+		}
+		return r
+
+	case a.BodyMatches != "":
+		re := regexp.MustCompile(a.BodyMatches)
+		r := assertionResult{name: "body matches " + a.BodyMatches, passed: re.MatchString(res.body)}
+		if !r.passed {
+			r.message = "no match"
+		}
+		return r
+
+	case a.Header != "":
+		values := res.headers.Values(a.Header)
+		value := strings.Join(values, ", ")
+		return a.compare("header "+a.Header, value, value, len(values) > 0)
+
+	default:
+		value, found, err := lookupJSON(res.body, a.JSONPath)
+		if err != nil {
+			return assertionResult{name: a.JSONPath, message: err.Error()}
+		}
+		return a.compare(a.JSONPath, value, jsonText(value), found)
+	}
+}
+
+// compare applies the check of a header or JSON assertion to value, whose
+// text form is text.
+func (a Assertion) compare(subject string, value any, text string, found bool) assertionResult {
+	switch {
+	case a.Exists != nil && !*a.Exists:
+		r := assertionResult{name: subject + " is absent", passed: !found}
+		if found {
+			r.message = "found " + text
+		}
+		return r
+
+	case a.Equals != nil:
+		var expected any
+		json.Unmarshal(a.Equals, &expected)
+		r := assertionResult{name: subject + " equals " + string(a.Equals)}
+		if !found {
+			r.message = "not found"
+			return r
+		}
+		if s, ok := value.(string); ok && a.Header != "" {
+			// Header values are text, so compare with the expected text
+			r.passed = s == jsonText(expected)
+		} else {
+			r.passed = reflect.DeepEqual(value, expected)
+		}
+		if !r.passed {
+			r.message = "got " + text
+		}
+		return r
+
+	case a.Contains != nil:
+		var expected any
+		json.Unmarshal(a.Contains, &expected)
+		r := assertionResult{name: subject + " contains " + string(a.Contains)}
+		if !found {
+			r.message = "not found"
+			return r
+		}
+		r.passed = contains(value, expected)
+		if !r.passed {
+			r.message = "got " + text
+		}
+		return r
+
+	case a.Matches != "":
+		r := assertionResult{name: subject + " matches " + a.Matches}
+		if !found {
+			r.message = "not found"
+			return r
+		}
+		r.passed = regexp.MustCompile(a.Matches).MatchString(text)
+		if !r.passed {
+			r.message = "got " + text
+		}
+		return r
+	}
+
+	r := assertionResult{name: subject + " exists", passed: found}
+	if !found {
+		r.message = "not found"
+	}
+	return r
+}
+
+// contains reports whether a string holds a substring, an array holds an
+// element or an object holds a key.
+func contains(value, expected any) bool {
+	switch v := value.(type) {
+	case string:
+		s, ok := expected.(string)
+		return ok && strings.Contains(v, s)
+	case []any:
+		for _, item := range v {
+			if reflect.DeepEqual(item, expected) {
+				return true
+			}
+		}
+	case map[string]any:
+		s, ok := expected.(string)
+		if ok {
+			_, found := v[s]
+			return found
+		}
+	}
+	return false
+}
+
+// hasStatusAssertion reports whether any assertion checks the status code.
+func hasStatusAssertion(assertions []Assertion) bool {
+	for _, a := range assertions {
+		if a.Status != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// testsSummary counts the passed tests, as in "3/4 tests passed".
+func testsSummary(results []assertionResult) string {
+	passed := 0
+	for _, r := range results {
+		if r.passed {
+			passed++
+		}
+	}
+	return fmt.Sprintf("%d/%d tests passed", passed, len(results))
+}
+
+// firstFailure describes the first failing test, or "" when all passed.
+func firstFailure(results []assertionResult) string {
+	for _, r := range results {
+		if !r.passed {
+			return r.name + ": " + r.message
+		}
+	}
+	return ""
+}
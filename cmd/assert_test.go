@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAssertions(t *testing.T) {
+	tests := []struct {
+		raw     string
+		status  string
+		wantErr string
+	}{
+		{raw: `[{"status": 200}]`, status: "200"},
+		{raw: `[{"status": "200"}]`, status: "200"},
+		{raw: `[{"status": "2xx"}]`, status: "2xx"},
+		{raw: `[{"status": "200-299"}]`, status: "200-299"},
+		{raw: `[{"status": null, "maxTime": "1s"}]`},
+		{raw: `[{"header": "X-Id"}]`},
+		{raw: `[{"status": true}]`, wantErr: "status takes a code"},
+		{raw: `[{"status": 200.5}]`, wantErr: "status takes a code"},
+		{raw: `[{"status": "abc"}]`, wantErr: "abc"},
+		{raw: `[{"status": 200, "equals": 200}]`, wantErr: "test 1: status takes a code"},
+		{raw: `[{"status": 200, "header": "X-Id"}]`, wantErr: "exactly one"},
+		{raw: `[{}]`, wantErr: "exactly one"},
+		{raw: `[{"header": "X-Id", "equals": "a", "matches": "a"}]`, wantErr: "only one of"},
+		{raw: `[{"header": "X-Id", "contains": 1}]`, wantErr: "header contains takes a string"},
+		{raw: `[{"header": "X-Id", "matches": "("}]`, wantErr: "matches:"},
+		{raw: `[{"bodyMatches": "("}]`, wantErr: "bodyMatches:"},
+		{raw: `[{"maxTime": "soon"}]`, wantErr: "maxTime:"},
+		{raw: `[{"jsonPath": "$.items[x]"}]`, wantErr: "bad index"},
+		{raw: `{"status": 200}`, wantErr: "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		assertions, err := parseAssertions(tt.raw)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.raw, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.raw, err)
+			continue
+		}
+		if len(assertions) != 1 || assertions[0].Status != tt.status {
+			t.Errorf("%s: parsed %+v", tt.raw, assertions)
+		}
+	}
+
+	if assertions, err := parseAssertions("  \n"); err != nil || len(assertions) != 0 {
+		t.Errorf("empty tests = %+v, %v", assertions, err)
+	}
+}
+
+func TestCheckAssertions(t *testing.T) {
+	res := result{
+		statusCode: 201,
+		status:     "201 Created",
+		headers: http.Header{
+			"Content-Type": {"application/json; charset=utf-8"},
+			"X-Id":         {"42"},
+			"Vary":         {"Accept", "Origin"},
+		},
+		body:    `{"data": {"id": 42, "name": "Ada", "tags": ["new", "admin"], "odd.key": true}, "items": [{"name": "first"}, {"name": "last"}], "none": null}`,
+		timings: &Timings{Total: 120 * time.Millisecond},
+	}
+
+	tests := []struct {
+		raw     string
+		name    string
+		passed  bool
+		message string
+	}{
+		// status code, class and range
+		{`{"status": 201}`, "status is 201", true, ""},
+		{`{"status": 200}`, "status is 200", false, "got 201 Created"},
+		{`{"status": "2xx"}`, "status is 2xx", true, ""},
+		{`{"status": "4xx"}`, "status is 4xx", false, "got 201 Created"},
+		{`{"status": "200-204"}`, "status is 200-204", true, ""},
+		{`{"status": "200, 404"}`, "status is 200, 404", false, "got 201 Created"},
+
+		// headers, whose names are case-insensitive
+		{`{"header": "x-id"}`, "header x-id exists", true, ""},
+		{`{"header": "X-Id", "equals": 42}`, "header X-Id equals 42", true, ""},
+		{`{"header": "X-Id", "equals": "42"}`, `header X-Id equals "42"`, true, ""},
+		{`{"header": "X-Id", "equals": "41"}`, `header X-Id equals "41"`, false, "got 42"},
+		{`{"header": "Content-Type", "matches": "json"}`, "header Content-Type matches json", true, ""},
+		{`{"header": "Content-Type", "matches": "^text/"}`, "header Content-Type matches ^text/", false, "got application/json; charset=utf-8"},
+		{`{"header": "Vary", "contains": "Origin"}`, `header Vary contains "Origin"`, true, ""},
+		{`{"header": "Set-Cookie", "exists": false}`, "header Set-Cookie is absent", true, ""},
+		{`{"header": "X-Id", "exists": false}`, "header X-Id is absent", false, "found 42"},
+		{`{"header": "Set-Cookie", "equals": "a"}`, `header Set-Cookie equals "a"`, false, "not found"},
+
+		// JSON values
+		{`{"jsonPath": "$.data.id", "equals": 42}`, "$.data.id equals 42", true, ""},
+		{`{"jsonPath": "$.data.id", "equals": "42"}`, `$.data.id equals "42"`, false, "got 42"},
+		{`{"jsonPath": "data.tags", "equals": ["new", "admin"]}`, `data.tags equals ["new", "admin"]`, true, ""},
+		{`{"jsonPath": "$.none", "equals": null}`, "$.none equals null", true, ""},
+		{`{"jsonPath": "$.data.tags", "contains": "new"}`, `$.data.tags contains "new"`, true, ""},
+		{`{"jsonPath": "$.data.tags", "contains": "old"}`, `$.data.tags contains "old"`, false, `got ["new","admin"]`},
+		{`{"jsonPath": "$.data.name", "contains": "Ad"}`, `$.data.name contains "Ad"`, true, ""},
+		{`{"jsonPath": "$.data", "contains": "odd.key"}`, `$.data contains "odd.key"`, true, ""},
+		{`{"jsonPath": "$.data.name", "matches": "^A"}`, "$.data.name matches ^A", true, ""},
+		{`{"jsonPath": "$.data.id"}`, "$.data.id exists", true, ""},
+		{`{"jsonPath": "$.none"}`, "$.none exists", true, ""},
+		{`{"jsonPath": "$.data.missing"}`, "$.data.missing exists", false, "not found"},
+		{`{"jsonPath": "$.data.missing", "exists": false}`, "$.data.missing is absent", true, ""},
+		{`{"jsonPath": "$.data['odd.key']", "equals": true}`, "$.data['odd.key'] equals true", true, ""},
+		{`{"jsonPath": "$.items[-1].name", "equals": "last"}`, `$.items[-1].name equals "last"`, true, ""},
+		{`{"jsonPath": "$.items[-2].name", "equals": "first"}`, `$.items[-2].name equals "first"`, true, ""},
+		{`{"jsonPath": "$.items[-3]"}`, "$.items[-3] exists", false, "not found"},
+		{`{"jsonPath": "$.items[2]"}`, "$.items[2] exists", false, "not found"},
+		{`{"jsonPath": "$.data[0]"}`, "$.data[0] exists", false, "not found"},
+
+		// body and time
+		{`{"bodyMatches": "\"name\":\\s*\"Ada\""}`, `body matches "name":\s*"Ada"`, true, ""},
+		{`{"bodyMatches": "Grace"}`, "body matches Grace", false, "no match"},
+		{`{"maxTime": "500ms"}`, "response time under 500ms", true, ""},
+		{`{"maxTime": "100ms"}`, "response time under 100ms", false, "took 120ms"},
+	}
+	for _, tt := range tests {
+		assertions, err := parseAssertions("[" + tt.raw + "]")
+		if err != nil {
+			t.Errorf("%s: %v", tt.raw, err)
+			continue
+		}
+		got := checkAssertions(assertions, res)
+		if len(got) != 1 {
+			t.Fatalf("%s: results %+v", tt.raw, got)
+		}
+		want := assertionResult{name: tt.name, passed: tt.passed, message: tt.message}
+		if got[0] != want {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.raw, got[0], want)
+		}
+	}
+}
+
+func TestCheckAssertionsEdgeCases(t *testing.T) {
+	assertions, err := parseAssertions(`[{"jsonPath": "$.id"}, {"maxTime": "1s"}, {"status": 200}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := checkAssertions(assertions, result{statusCode: 200, status: "200 OK", body: "not json"})
+	if results[0].passed || results[0].message == "" {
+		t.Errorf("a body that isn't JSON = %+v", results[0])
+	}
+	if results[1].passed || results[1].message != "no timing recorded" {
+		t.Errorf("missing timings = %+v", results[1])
+	}
+	if summary := testsSummary(results); summary != "1/3 tests passed" {
+		t.Errorf("summary = %q", summary)
+	}
+	if failure := firstFailure(results); !strings.HasPrefix(failure, "$.id: ") {
+		t.Errorf("first failure = %q", failure)
+	}
+	if !hasStatusAssertion(assertions) || hasStatusAssertion(assertions[:2]) {
+		t.Error("hasStatusAssertion missed or invented a status test")
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "$", want: ""},
+		{path: "", want: ""},
+		{path: "$.data.id", want: ".data.id"},
+		{path: "data.id", want: ".data.id"},
+		{path: " $.items[0].name ", want: ".items[0].name"},
+		{path: "$.items[-1]", want: ".items[-1]"},
+		{path: "$[2][ -3 ]", want: "[2][-3]"},
+		{path: `$["odd.key"].x`, want: ".odd.key.x"},
+		{path: `$['a b']`, want: ".a b"},
+		{path: "$.a..b", wantErr: "empty key"},
+		{path: "$.a.", wantErr: "empty key"},
+		{path: "$.items[0", wantErr: "missing ]"},
+		{path: "$.items[one]", wantErr: `bad index "one"`},
+		{path: "$.items[]", wantErr: `bad index ""`},
+	}
+	for _, tt := range tests {
+		segments, err := parseJSONPath(tt.path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: err = %v, want %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.path, err)
+			continue
+		}
+		var got strings.Builder
+		for _, s := range segments {
+			if s.index != nil {
+				got.WriteString("[" + strconv.Itoa(*s.index) + "]")
+			} else {
+				got.WriteString("." + s.key)
+			}
+		}
+		if got.String() != tt.want {
+			t.Errorf("%q = %q, want %q", tt.path, got.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Auth types of a Request, named as in Postman collections.
+const (
+	authNone   = "none"
+	authBasic  = "basic"
+	authBearer = "bearer"
+	authAPIKey = "apikey"
+	authDigest = "digest"
+	authOAuth2 = "oauth2"
+	authAWSv4  = "awsv4"
+)
+
+// authTypes is the order Ctrl+t cycles through in the Auth tab.
+var authTypes = []string{authNone, authBasic, authBearer, authAPIKey, authDigest, authOAuth2, authAWSv4}
+
+var authTypeLabels = map[string]string{
+	authNone:   "None",
+	authBasic:  "Basic",
+	authBearer: "Bearer token",
+	authAPIKey: "API key",
+	authDigest: "Digest",
+	authOAuth2: "OAuth 2.0",
+	authAWSv4:  "AWS Signature",
+}
+
+// authTypeHints explain each auth type in the Auth tab.
+var authTypeHints = map[string]string{
+	authNone:   "no credentials are added",
+	authBasic:  "sent as Authorization: Basic",
+	authBearer: "sent as Authorization: Bearer",
+	authDigest: "answers the server's 401 challenge",
+	authAWSv4:  "signs the whole request with Signature Version 4",
+}
+
+// Auth is how a request authenticates. Its fields may hold {{placeholders}},
+// which are resolved when the request is sent.
+type Auth struct {
+	Type     string `json:"type"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	// Key and Value name an API key, sent in the header or query param
+	// chosen by In
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+	In    string `json:"in,omitempty"`
+	// OAuth 2.0 settings. The access token is fetched with Grant when the
+	// request is sent, and is cached rather than saved with the request.
+	Grant        string `json:"grant,omitempty"`
+	TokenURL     string `json:"tokenUrl,omitempty"`
+	AuthURL      string `json:"authUrl,omitempty"`
+	RedirectURI  string `json:"redirectUri,omitempty"`
+	ClientID     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	// AWS Signature V4 credentials and the scope the request is signed for
+	AccessKey    string `json:"accessKey,omitempty"`
+	SecretKey    string `json:"secretKey,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Service      string `json:"service,omitempty"`
+}
+
+// authField is a row of the Auth tab. key names it in Postman collections.
+type authField struct {
+	name  string
+	key   string
+	hint  string
+	value func(a *Auth) *string
+}
+
+var (
+	usernameField = authField{"Username", "username", "", func(a *Auth) *string { return &a.Username }}
+	passwordField = authField{"Password", "password", "", func(a *Auth) *string { return &a.Password }}
+)
+
+// authFields are the rows of the Auth tab for each type.
+var authFields = map[string][]authField{
+	authBasic: {usernameField, passwordField},
+	authBearer: {
+		{"Token", "token", "", func(a *Auth) *string { return &a.Token }},
+	},
+	authAPIKey: {
+		{"Key", "key", "name of the header or param", func(a *Auth) *string { return &a.Key }},
+		{"Value", "value", "", func(a *Auth) *string { return &a.Value }},
+		{"In", "in", "header or query, header if blank", func(a *Auth) *string { return &a.In }},
+	},
+	authDigest: {usernameField, passwordField},
+	authOAuth2: {
+		{"Grant", "grant_type", "client_credentials, password, refresh_token or authorization_code", func(a *Auth) *string { return &a.Grant }},
+		{"Token URL", "accessTokenUrl", "", func(a *Auth) *string { return &a.TokenURL }},
+		{"Client ID", "clientId", "", func(a *Auth) *string { return &a.ClientID }},
+		{"Client secret", "clientSecret", "blank for public clients", func(a *Auth) *string { return &a.ClientSecret }},
+		{"Scope", "scope", "", func(a *Auth) *string { return &a.Scope }},
+		{"Username", "username", "password grant", func(a *Auth) *string { return &a.Username }},
+		{"Password", "password", "password grant", func(a *Auth) *string { return &a.Password }},
+		{"Refresh token", "refreshToken", "refresh_token grant", func(a *Auth) *string { return &a.RefreshToken }},
+		{"Auth URL", "authUrl", "authorization_code grant", func(a *Auth) *string { return &a.AuthURL }},
+		{"Redirect URI", "redirect_uri", "authorization_code grant, a free localhost port if blank", func(a *Auth) *string { return &a.RedirectURI }},
+	},
+	authAWSv4: {
+		{"Access key", "accessKey", "AWS_ACCESS_KEY_ID if blank", func(a *Auth) *string { return &a.AccessKey }},
+		{"Secret key", "secretKey", "AWS_SECRET_ACCESS_KEY if blank", func(a *Auth) *string { return &a.SecretKey }},
+		{"Session token", "sessionToken", "temporary credentials, AWS_SESSION_TOKEN if blank", func(a *Auth) *string { return &a.SessionToken }},
+		{"Region", "region", "AWS_REGION if blank", func(a *Auth) *string { return &a.Region }},
+		{"Service", "service", "such as execute-api or s3, taken from amazonaws.com hosts if blank", func(a *Auth) *string { return &a.Service }},
+	},
+}
+
+// rows returns the fields of the auth type as rows of the Auth tab.
+func (a Auth) rows() KeyValues {
+	var rows KeyValues
+	for _, f := range authFields[a.Type] {
+		rows = append(rows, KeyValue{Key: f.name, Value: *f.value(&a), Description: f.hint})
+	}
+	return rows
+}
+
+// setRows copies the values edited in the Auth tab into a. Fields of other
+// types are kept, so switching types doesn't lose what was typed.
+func (a *Auth) setRows(rows KeyValues) {
+	for _, f := range authFields[a.Type] {
+		for _, kv := range rows {
+			if kv.Key == f.name {
+				*f.value(a) = kv.Value
+			}
+		}
+	}
+}
+
+// saved returns a with only the fields of its type, or nil when the request
+// has no auth.
+func (a Auth) saved() *Auth {
+	if a.Type == "" || a.Type == authNone {
+		return nil
+	}
+	clean := Auth{Type: a.Type}
+	for _, f := range authFields[a.Type] {
+		*f.value(&clean) = *f.value(&a)
+	}
+	return &clean
+}
+
+// resolved returns a with resolve applied to each of its fields.
+func (a *Auth) resolved(resolve func(string) string) Auth {
+	if a == nil {
+		return Auth{Type: authNone}
+	}
+	resolved := *a
+	for _, f := range authFields[a.Type] {
+		*f.value(&resolved) = resolve(*f.value(&resolved))
+	}
+	return resolved
+}
+
+// texts returns the fields placeholders are resolved in.
+func (a *Auth) texts() []string {
+	if a == nil {
+		return nil
+	}
+	var texts []string
+	for _, f := range authFields[a.Type] {
+		texts = append(texts, *f.value(a))
+	}
+	return texts
+}
+
+// applyAuth adds the credentials of a, already resolved, to req. An
+// Authorization header typed in the Headers tab takes the place of basic,
+// bearer, digest and AWS Signature auth. Digest credentials are left on the
+// request for digestTransport, which answers the server's challenge, and
+// AWS Signature is added by buildRequest once the request is complete.
+func applyAuth(req *http.Request, a Auth) (*http.Request, error) {
+	typed := req.Header.Get("Authorization") != ""
+	switch a.Type {
+	case authBasic:
+		if !typed {
+			req.SetBasicAuth(a.Username, a.Password)
+		}
+	case authBearer:
+		if strings.TrimSpace(a.Token) == "" {
+			return nil, fmt.Errorf("the bearer token is empty")
+		}
+		if !typed {
+			req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(a.Token))
+		}
+	case authAPIKey:
+		if strings.TrimSpace(a.Key) == "" {
+			return nil, fmt.Errorf("the API key has no name")
+		}
+		switch strings.ToLower(strings.TrimSpace(a.In)) {
+		case "query":
+			if req.URL.RawQuery != "" {
+				req.URL.RawQuery += "&"
+			}
+			req.URL.RawQuery += encodeQuery(KeyValues{{Key: a.Key, Value: a.Value}})
+		case "header", "":
+			if req.Header.Get(a.Key) == "" {
+				req.Header.Set(a.Key, a.Value)
+			}
+		default:
+			return nil, fmt.Errorf("the API key goes in a header or query, not %q", a.In)
+		}
+	case authOAuth2:
+		// The token was fetched by authorizeOAuth2, an export without one
+		// leaves the header out
+		if a.Token != "" && !typed {
+			req.Header.Set("Authorization", "Bearer "+a.Token)
+		}
+	case authDigest:
+		if !typed {
+			credentials := digestCredentials{host: req.URL.Host, username: a.Username, password: a.Password}
+			req = req.WithContext(context.WithValue(req.Context(), digestCredentials{}, credentials))
+		}
+	}
+	return req, nil
+}
+
+// digestCredentials are carried in the context of a request using digest
+// auth. They are only sent to the host the request was made to.
+type digestCredentials struct {
+	host     string
+	username string
+	password string
+}
+
+// digestAuth returns the digest auth a built request answers challenges
+// with, nil if it has none.
+func digestAuth(req *http.Request) *Auth {
+	credentials, ok := req.Context().Value(digestCredentials{}).(digestCredentials)
+	if !ok {
+		return nil
+	}
+	return &Auth{Type: authDigest, Username: credentials.username, Password: credentials.password}
+}
+
+// digestTransport sends requests carrying digestCredentials once without
+// them and, when the server answers 401 with a Digest challenge, once more
+// with the response to it.
+type digestTransport struct {
+	next http.RoundTripper
+}
+
+func (t digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	credentials, ok := req.Context().Value(digestCredentials{}).(digestCredentials)
+	if !ok || credentials.host != req.URL.Host || req.Header.Get("Authorization") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge, ok := digestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return resp, nil
+	}
+	authorization, err := digestAuthorization(challenge, credentials, req.Method, req.URL.RequestURI())
+	if err != nil {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", authorization)
+	return t.next.RoundTrip(retry)
+}
+
+// digestChallenge finds the Digest challenge among WWW-Authenticate headers
+// and reads its parameters.
+func digestChallenge(headers []string) (map[string]string, bool) {
+	for _, header := range headers {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		return parseAuthParams(rest), true
+	}
+	return nil, false
+}
+
+// parseAuthParams reads the comma separated key=value parameters of a
+// challenge, where values may be quoted.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " ")
+
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			rest = rest[min(i+1, len(rest)):]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value.WriteString(strings.TrimSpace(rest[:end]))
+			rest = rest[end:]
+		}
+		params[key] = value.String()
+		s = rest
+	}
+}
+
+// digestAuthorization answers a challenge as described in RFC 7616, for the
+// MD5 and SHA-256 algorithms with qop auth or without qop.
+func digestAuthorization(challenge map[string]string, c digestCredentials, method, uri string) (string, error) {
+	algorithm := challenge["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %s", algorithm)
+	}
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	qop := ""
+	if offered, ok := challenge["qop"]; ok {
+		for _, q := range strings.Split(offered, ",") {
+			if strings.TrimSpace(q) == "auth" {
+				qop = "auth"
+			}
+		}
+		if qop == "" {
+			return "", fmt.Errorf("unsupported digest qop %s", offered)
+		}
+	}
+
+	nonce, realm := challenge["nonce"], challenge["realm"]
+	cnonceBytes := make([]byte, 16)
+	rand.Read(cnonceBytes)
+	cnonce := hex.EncodeToString(cnonceBytes)
+	nc := "00000001"
+
+	ha1 := h(c.username + ":" + realm + ":" + c.password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	parts := []string{
+		fmt.Sprintf("username=%q", c.username),
+		fmt.Sprintf("realm=%q", realm),
+		fmt.Sprintf("nonce=%q", nonce),
+		fmt.Sprintf("uri=%q", uri),
+		"algorithm=" + algorithm,
+		fmt.Sprintf("response=%q", response),
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		parts = append(parts, fmt.Sprintf("opaque=%q", opaque))
+	}
+	if qop != "" {
+		parts = append(parts, "qop="+qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	return "Digest " + strings.Join(parts, ", "), nil
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// digestAttempt is one request the digest test server received.
+type digestAttempt struct {
+	authorization string
+	contentType   string
+	body          string
+}
+
+// digestServer challenges requests without credentials and accepts those
+// whose digest response matches ada's password.
+func digestServer(t *testing.T, algorithm, qop string) (*httptest.Server, *[]digestAttempt) {
+	t.Helper()
+	var attempts []digestAttempt
+	newHash := md5.New
+	if algorithm == "SHA-256" {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		authorization := r.Header.Get("Authorization")
+		attempts = append(attempts, digestAttempt{authorization, r.Header.Get("Content-Type"), string(body)})
+
+		scheme, rest, _ := strings.Cut(authorization, " ")
+		if scheme != "Digest" {
+			challenge := `Digest realm="test \"realm\"", nonce="abc123", opaque="xyz", algorithm=` + algorithm
+			if qop != "" {
+				challenge += `, qop="` + qop + `"`
+			}
+			w.Header().Add("WWW-Authenticate", `Basic realm="other"`)
+			w.Header().Add("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		p := parseAuthParams(rest)
+		ha1 := h("ada:" + `test "realm"` + ":digest-pass")
+		ha2 := h(r.Method + ":" + r.URL.RequestURI())
+		want := h(ha1 + ":abc123:" + ha2)
+		if qop != "" {
+			want = h(ha1 + ":abc123:" + p["nc"] + ":" + p["cnonce"] + ":auth:" + ha2)
+		}
+		if p["username"] != "ada" || p["uri"] != r.URL.RequestURI() || p["opaque"] != "xyz" || p["response"] != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("welcome"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &attempts
+}
+
+func TestDigestAuthRetriesWithTheBody(t *testing.T) {
+	useTempData(t)
+
+	tests := []struct {
+		name      string
+		algorithm string
+		qop       string
+		request   Request
+		body      string
+	}{
+		{"text", "MD5", "auth", Request{Method: "POST", BodyType: bodyText, Body: "hello {{name}}"}, "hello ada"},
+		{"form", "MD5", "auth-int,auth", Request{Method: "PUT", BodyType: bodyForm, Form: KeyValues{{Key: "name", Value: "{{name}}"}, {Key: "off", Value: "x", Disabled: true}}}, "name=ada"},
+		{"multipart", "SHA-256", "auth", Request{Method: "POST", BodyType: bodyMultipart, Form: KeyValues{{Key: "name", Value: "{{name}}"}}}, ""},
+		{"no qop", "MD5", "", Request{Method: "GET"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, attempts := digestServer(t, tt.algorithm, tt.qop)
+			r := tt.request
+			r.URL = server.URL + "/secure?page=2"
+			r.Auth = &Auth{Type: authDigest, Username: "ada", Password: "digest-pass"}
+
+			res := execute(context.Background(), r, "", map[string]string{"name": "ada"})
+			if res.statusCode != http.StatusOK || res.body != "welcome" {
+				t.Fatalf("status %q, body %q", res.status, res.body)
+			}
+			if len(*attempts) != 2 {
+				t.Fatalf("%d requests, want the first and one answering the challenge", len(*attempts))
+			}
+			first, retry := (*attempts)[0], (*attempts)[1]
+			if first.authorization != "" {
+				t.Errorf("the first request sent %q before the challenge", first.authorization)
+			}
+			if !strings.HasPrefix(retry.authorization, "Digest ") || !strings.Contains(retry.authorization, "algorithm="+tt.algorithm) {
+				t.Errorf("Authorization = %q", retry.authorization)
+			}
+			if tt.qop != "" && !strings.Contains(retry.authorization, "qop=auth, nc=00000001") {
+				t.Errorf("Authorization = %q, want qop auth", retry.authorization)
+			}
+			if retry.body != first.body || retry.contentType != first.contentType {
+				t.Errorf("the retry sent %q (%s), the first request %q (%s)", retry.body, retry.contentType, first.body, first.contentType)
+			}
+			if tt.body != "" && retry.body != tt.body {
+				t.Errorf("body = %q, want %q", retry.body, tt.body)
+			}
+			if r.BodyType == bodyMultipart {
+				if fields := multipartFields(t, []byte(retry.body), retry.contentType); fields["name"] != "ada" {
+					t.Errorf("multipart fields = %v", fields)
+				}
+			}
+		})
+	}
+}
+
+func TestDigestAuthWrongPassword(t *testing.T) {
+	useTempData(t)
+	server, attempts := digestServer(t, "MD5", "auth")
+	r := Request{Method: "GET", URL: server.URL, Auth: &Auth{Type: authDigest, Username: "ada", Password: "wrong"}}
+
+	res := execute(context.Background(), r, "", map[string]string{})
+	if res.statusCode != http.StatusUnauthorized {
+		t.Errorf("status = %q, want the server's 401", res.status)
+	}
+	if len(*attempts) != 2 {
+		t.Errorf("%d requests, want a single retry", len(*attempts))
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	credentials := digestCredentials{username: "Mufasa", password: "Circle of Life"}
+	challenge := map[string]string{"realm": "http-auth@example.org", "nonce": "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", "opaque": "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", "qop": "auth", "algorithm": "SHA-256"}
+
+	authorization, err := digestAuthorization(challenge, credentials, "GET", "/dir/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parseAuthParams(strings.TrimPrefix(authorization, "Digest "))
+	sum := func(newHash func() hash.Hash, s string) string {
+		h := newHash()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	ha1 := sum(sha256.New, "Mufasa:http-auth@example.org:Circle of Life")
+	ha2 := sum(sha256.New, "GET:/dir/index.html")
+	want := sum(sha256.New, ha1+":"+challenge["nonce"]+":00000001:"+p["cnonce"]+":auth:"+ha2)
+	if p["response"] != want || p["opaque"] != challenge["opaque"] || p["qop"] != "auth" || len(p["cnonce"]) != 32 {
+		t.Errorf("Authorization = %s", authorization)
+	}
+
+	// With -sess the first hash also covers the nonces
+	challenge["algorithm"] = "MD5-sess"
+	authorization, _ = digestAuthorization(challenge, credentials, "GET", "/")
+	p = parseAuthParams(strings.TrimPrefix(authorization, "Digest "))
+	ha1 = sum(md5.New, sum(md5.New, "Mufasa:http-auth@example.org:Circle of Life")+":"+challenge["nonce"]+":"+p["cnonce"])
+	want = sum(md5.New, ha1+":"+challenge["nonce"]+":00000001:"+p["cnonce"]+":auth:"+sum(md5.New, "GET:/"))
+	if p["response"] != want || p["algorithm"] != "MD5-sess" {
+		t.Errorf("Authorization = %s", authorization)
+	}
+
+	for _, c := range []map[string]string{{"algorithm": "SHA-512-256"}, {"qop": "auth-int"}} {
+		if _, err := digestAuthorization(c, credentials, "GET", "/"); err == nil {
+			t.Errorf("%v was answered", c)
+		}
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	tests := []struct {
+		input string
+		want  map[string]string
+	}{
+		{`realm="test", nonce=abc, qop="auth,auth-int"`, map[string]string{"realm": "test", "nonce": "abc", "qop": "auth,auth-int"}},
+		{`Realm = "a, b" ,NONCE= x `, map[string]string{"realm": "a, b", "nonce": "x"}},
+		{`realm="say \"hi\"", opaque="back\\slash"`, map[string]string{"realm": `say "hi"`, "opaque": `back\slash`}},
+		{`realm="", stale=true`, map[string]string{"realm": "", "stale": "true"}},
+		{`realm="unterminated`, map[string]string{"realm": "unterminated"}},
+		{`realm="ends in \`, map[string]string{"realm": `ends in \`}},
+		{`novalue`, map[string]string{}},
+		{``, map[string]string{}},
+	}
+	for _, tt := range tests {
+		got := parseAuthParams(tt.input)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s = %q, want %q", tt.input, got, tt.want)
+			continue
+		}
+		for key, value := range tt.want {
+			if got[key] != value {
+				t.Errorf("%s: %s = %q, want %q", tt.input, key, got[key], value)
+			}
+		}
+	}
+
+	if _, ok := digestChallenge([]string{`Basic realm="x"`, `digest realm="y"`}); !ok {
+		t.Error("the Digest challenge wasn't found")
+	}
+	if _, ok := digestChallenge([]string{`Bearer realm="x"`}); ok {
+		t.Error("found a Digest challenge among others")
+	}
+}
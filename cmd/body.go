@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Body types of a Request. Requests saved before body types existed have
+// none set and send their Body as it is.
+const (
+	bodyNone      = "none"
+	bodyJSON      = "json"
+	bodyText      = "text"
+	bodyXML       = "xml"
+	bodyForm      = "form"
+	bodyMultipart = "multipart"
+	bodyBinary    = "binary"
+)
+
+// formFile is the Type of multipart form rows that upload a file.
+const formFile = "file"
+
+// bodyTypes is the order Ctrl+t cycles through in the Body tab.
+var bodyTypes = []string{bodyNone, bodyJSON, bodyText, bodyXML, bodyForm, bodyMultipart, bodyBinary}
+
+var bodyTypeLabels = map[string]string{
+	bodyNone:      "None",
+	bodyJSON:      "JSON",
+	bodyText:      "Text",
+	bodyXML:       "XML",
+	bodyForm:      "Form URL-encoded",
+	bodyMultipart: "Multipart form",
+	bodyBinary:    "Binary file",
+}
+
+// bodyTypeHints explain how the Body tab is filled in for each type.
+var bodyTypeHints = map[string]string{
+	bodyNone:      "this request is sent without a body",
+	bodyForm:      "each row is a form field",
+	bodyMultipart: "ctrl+f makes a row a file, its value the path to upload",
+	bodyBinary:    "the path of the file to send",
+}
+
+// requestBody builds the body of r, applying resolve to everything typed. It
+// returns the Content-Type that goes with the body, "" when there is none.
+func requestBody(r Request, resolve func(string) string) ([]byte, string, error) {
+	switch r.BodyType {
+	case bodyNone:
+		return nil, "", nil
+	case bodyJSON, bodyText, bodyXML:
+		content := resolve(r.Body)
+		if content == "" {
+			return nil, "", nil
+		}
+		contentType := map[string]string{
+			bodyJSON: "application/json",
+			bodyText: "text/plain; charset=utf-8",
+			bodyXML:  "application/xml",
+		}[r.BodyType]
+		return []byte(content), contentType, nil
+	case bodyForm:
+		fields := r.Form.resolved(resolve)
+		if len(fields) == 0 {
+			return nil, "", nil
+		}
+		return []byte(encodeQuery(fields)), "application/x-www-form-urlencoded", nil
+	case bodyMultipart:
+		fields := r.Form.resolved(resolve)
+		if len(fields) == 0 {
+			return nil, "", nil
+		}
+		return multipartBody(fields)
+	case bodyBinary:
+		path := strings.TrimSpace(resolve(r.BodyFile))
+		if path == "" {
+			return nil, "", nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return content, fileContentType(path), nil
+	}
+
+	if content := resolve(r.Body); content != "" {
+		return []byte(content), "", nil
+	}
+	return nil, "", nil
+}
+
+// multipartBody writes fields as a multipart/form-data body. Rows of type
+// formFile upload the file their value names, other rows are sent as text.
+func multipartBody(fields KeyValues) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	for _, field := range fields {
+		if field.Type != formFile {
+			if err := w.WriteField(field.Key, field.Value); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+
+		path := strings.TrimSpace(field.Value)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, field.Key, filepath.Base(path)))
+		h.Set("Content-Type", fileContentType(path))
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		part.Write(content)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+// fileContentType guesses the Content-Type of a file from its extension.
+func fileContentType(path string) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// bodyTexts returns the parts of the body of r that placeholders are
+// resolved in.
+func bodyTexts(r Request) []string {
+	switch r.BodyType {
+	case bodyNone:
+		return nil
+	case bodyForm, bodyMultipart:
+		return r.Form.texts()
+	case bodyBinary:
+		return []string{r.BodyFile}
+	}
+	return []string{r.Body}
+}
+
+// inferBodyType picks the body type shown in the editor for a request saved
+// before body types existed. Its headers already carry any Content-Type, so
+// the body is still sent as it was.
+func inferBodyType(r Request) string {
+	contentType, _ := r.Headers.header("Content-Type")
+	switch {
+	case strings.TrimSpace(r.Body) == "":
+		return bodyNone
+	case strings.Contains(contentType, "json"):
+		return bodyJSON
+	case strings.Contains(contentType, "xml"):
+		return bodyXML
+	case json.Valid([]byte(r.Body)):
+		return bodyJSON
+	}
+	return bodyText
+}
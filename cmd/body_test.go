@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFormTableSwitchesRowType(t *testing.T) {
+	table := newKVTable()
+	table.typed = true
+	table.SetRows(KeyValues{{Key: "image", Value: "front.png"}})
+
+	table, _ = table.Update(tea.KeyMsg{Type: tea.KeyCtrlF})
+	if got := table.Rows()[0].Type; got != formFile {
+		t.Fatalf("type after ctrl+f = %q, want %q", got, formFile)
+	}
+	if view := table.View(); !strings.Contains(view, "file ") {
+		t.Errorf("view doesn't mark the file row:\n%s", view)
+	}
+	table, _ = table.Update(tea.KeyMsg{Type: tea.KeyCtrlF})
+	if got := table.Rows()[0].Type; got != "" {
+		t.Errorf("type after a second ctrl+f = %q, want text", got)
+	}
+
+	// Other tables have no row types
+	table.typed = false
+	table, _ = table.Update(tea.KeyMsg{Type: tea.KeyCtrlF})
+	if got := table.Rows()[0].Type; got != "" {
+		t.Errorf("untyped table set the type to %q", got)
+	}
+}
+
+func TestMultipartUploadsFileRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "note.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r := Request{
+		BodyType: bodyMultipart,
+		Form:     KeyValues{{Key: "upload", Value: "{{file}}", Type: formFile}, {Key: "path", Value: path}},
+	}
+	content, contentType, err := requestBody(r, func(s string) string { return strings.ReplaceAll(s, "{{file}}", path) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := multipartFields(t, content, contentType)
+	if fields["upload"] != "file note.txt" {
+		t.Errorf("upload = %q, want the file", fields["upload"])
+	}
+	if fields["path"] != path {
+		t.Errorf("path = %q, want the text of the row", fields["path"])
+	}
+	if !strings.Contains(string(content), "hello") {
+		t.Error("the file's content wasn't sent")
+	}
+}
+
+func TestCtrlTInFormBody(t *testing.T) {
+	useTempData(t)
+	m := NewModel()
+	m.activeTab = bodyTab
+	m.bodyType = bodyForm
+	m.formTable.SetRows(KeyValues{{Key: "user", Value: "ada"}})
+	m.focused = 3
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlT})
+	m = model.(Model)
+	if m.bodyType != bodyForm {
+		t.Fatalf("ctrl+t in the table changed the body type to %q", m.bodyType)
+	}
+	if rows := m.formTable.Rows(); len(rows) != 1 || !rows[0].Disabled {
+		t.Errorf("rows after ctrl+t = %+v, want the row disabled", rows)
+	}
+	if form := m.request().Form; len(form) != 1 || !form[0].Disabled {
+		t.Errorf("request form = %+v", form)
+	}
+
+	// Outside the table ctrl+t still changes the type
+	m.focused = 2
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlT})
+	m = model.(Model)
+	if m.bodyType == bodyForm {
+		t.Error("ctrl+t outside the table kept the body type")
+	}
+}
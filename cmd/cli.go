@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const usage = `Usage:
+  gostman                       start the terminal UI
+  gostman run [--env NAME] [--var KEY=VALUE]... [--fail-status LIST] [--body] <name|id>
+                                send a saved request and print the response;
+                                exits 1 on errors and 3 when a test fails or the
+                                status is in --fail-status (default 4xx,5xx)
+  gostman run-collection [--env NAME] [--var KEY=VALUE]... [--fail-status LIST]
+                         [--bail] [--iterations N] [--delay DURATION] [folder]
+                                send every saved request in folder (default: all)
+                                in order and print a summary table
+  gostman import curl [--name NAME] < command.txt
+                                save the curl command read from stdin as a request
+  gostman import postman <file>...
+                                import Postman v2.1 collections and environments
+  gostman export curl [--env NAME] [--raw] <name|id>
+                                print a saved request as a curl command
+  gostman export postman [--name NAME] [--output FILE]
+                                write the saved requests as a Postman v2.1 collection
+  gostman help                  show this help`
+
+// Execute runs gostman as a command line tool with the given arguments and
+// returns the exit code.
+func Execute(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "run":
+		return runCommand(args[1:])
+	case "run-collection":
+		return runCollectionCommand(args[1:])
+	case "import":
+		return importCommand(args[1:])
+	case "export":
+		return exportCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", args[0], usage)
+		return 2
+	}
+}
+
+func importCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "import needs a format: curl, postman")
+		return 2
+	}
+
+	switch args[0] {
+	case "curl":
+		flags := flag.NewFlagSet("import curl", flag.ContinueOnError)
+		name := flags.String("name", "", "name of the saved request")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		command, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to read stdin:", err)
+			return 1
+		}
+
+		request, err := parseCurl(string(command))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to parse curl command:", err)
+			return 1
+		}
+		if *name != "" {
+			request.Name = *name
+		}
+
+		id := SaveRequests(request)
+		if id == "" {
+			return 1
+		}
+		fmt.Printf("Imported %s (%s)\n", request.Name, id)
+		return 0
+	case "postman":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "import postman needs at least one file")
+			return 2
+		}
+
+		for _, path := range args[1:] {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "failed to read file:", err)
+				return 1
+			}
+
+			var summary string
+			err = updateSavedData(func(saved *SavedData) error {
+				var err error
+				summary, err = importPostman(data, saved)
+				return err
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to import %s: %s\n", path, err)
+				return 1
+			}
+			fmt.Println(summary)
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown import format %q\n", args[0])
+		return 2
+	}
+}
+
+func exportCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "export needs a format: curl, postman")
+		return 2
+	}
+
+	switch args[0] {
+	case "curl":
+		flags := flag.NewFlagSet("export curl", flag.ContinueOnError)
+		envName := flags.String("env", "", "environment to resolve variables from (default: the active one)")
+		raw := flags.Bool("raw", false, "keep {{placeholders}} instead of resolving them")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if flags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "export curl needs the name or id of a saved request")
+			return 2
+		}
+
+		saved := getSavedData()
+		request, err := findRequest(saved, flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		variables, err := saved.variables(*envName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to load variables:", err)
+			return 1
+		}
+
+		command, err := exportCurl(request, variables, *raw)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to export request:", strings.TrimSpace(err.Error()))
+			return 1
+		}
+		fmt.Println(command)
+		return 0
+	case "postman":
+		flags := flag.NewFlagSet("export postman", flag.ContinueOnError)
+		name := flags.String("name", "", "name of the collection (default: the shared top folder)")
+		output := flags.String("output", "", "file to write instead of stdout")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		collection, err := exportPostman(getSavedData(), *name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to export requests:", err)
+			return 1
+		}
+
+		if *output == "" {
+			fmt.Println(string(collection))
+			return 0
+		}
+		if err := os.WriteFile(*output, append(collection, '\n'), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to write collection:", err)
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown export format %q\n", args[0])
+		return 2
+	}
+}
@@ -0,0 +1,717 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// parseCurl converts a curl command line, as copied from API docs or browser
+// devtools, into a Request. The query string of the URL is moved into the
+// Params tab.
+func parseCurl(command string) (Request, error) {
+	words, err := splitShellWords(command)
+	if err != nil {
+		return Request{}, err
+	}
+	if len(words) > 0 && (words[0] == "curl" || strings.HasSuffix(words[0], "/curl") || words[0] == "curl.exe") {
+		words = words[1:]
+	}
+
+	var (
+		method     string
+		rawURL     string
+		headers    [][2]string
+		data       []string
+		dataFile   string
+		forms      []formField
+		user       string
+		digest     bool
+		bearer     string
+		awsSigV4   string
+		cookies    []string
+		compressed bool
+		getData    bool
+		head       bool
+	)
+
+	// value returns the argument of the flag at words[i], which is either
+	// attached to a short flag (-XPOST), given with = (--request=POST) or the
+	// next word.
+	value := func(i *int, flag, attached string) (string, error) {
+		if attached != "" {
+			return attached, nil
+		}
+		if *i+1 >= len(words) {
+			return "", fmt.Errorf("missing value for %s", flag)
+		}
+		*i++
+		return words[*i], nil
+	}
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+
+		if !strings.HasPrefix(word, "-") || word == "-" {
+			if rawURL == "" {
+				rawURL = word
+			}
+			continue
+		}
+
+		flag, attached := word, ""
+		if strings.HasPrefix(word, "--") {
+			if name, v, ok := strings.Cut(word, "="); ok {
+				flag, attached = name, v
+			}
+		} else if len(word) > 2 {
+			// Short flags can be grouped (-sSL) and the last one may carry its
+			// value (-XPOST, -sXPOST)
+			flag = ""
+			for j, c := range word[1:] {
+				f := "-" + string(c)
+				if curlTakesValue(f) {
+					flag, attached = f, word[2+j:]
+					break
+				}
+				switch f {
+				case "-G":
+					getData = true
+				case "-I":
+					head = true
+				}
+			}
+			if flag == "" {
+				continue
+			}
+		}
+
+		switch flag {
+		case "-X", "--request":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			method = strings.ToUpper(v)
+		case "--url":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			rawURL = v
+		case "-H", "--header":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			key, val, ok := strings.Cut(v, ":")
+			if !ok {
+				continue
+			}
+			headers = append(headers, [2]string{strings.TrimSpace(key), strings.TrimSpace(val)})
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--json":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			if flag != "--data-raw" && strings.HasPrefix(v, "@") {
+				content, err := os.ReadFile(v[1:])
+				if err != nil {
+					return Request{}, fmt.Errorf("failed to read %s: %w", v[1:], err)
+				}
+				if flag == "--data-binary" {
+					dataFile = v[1:]
+				}
+				v = string(content)
+				if flag != "--data-binary" && flag != "--json" {
+					// curl strips newlines from files sent with -d
+					v = strings.NewReplacer("\r", "", "\n", "").Replace(v)
+				}
+			}
+			if flag == "--json" {
+				headers = append(headers, [2]string{"Content-Type", "application/json"}, [2]string{"Accept", "application/json"})
+			}
+			data = append(data, v)
+		case "--data-urlencode":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			encoded, err := curlURLEncode(v)
+			if err != nil {
+				return Request{}, err
+			}
+			data = append(data, encoded)
+		case "-F", "--form", "--form-string":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			forms = append(forms, formField{value: v, literal: flag == "--form-string"})
+		case "-u", "--user":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			user = v
+		case "-b", "--cookie":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			// Without "=" the value names a cookie jar file, which isn't sent
+			if strings.Contains(v, "=") {
+				cookies = append(cookies, v)
+			}
+		case "-A", "--user-agent":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			headers = append(headers, [2]string{"User-Agent", v})
+		case "-e", "--referer":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			headers = append(headers, [2]string{"Referer", v})
+		case "--digest":
+			digest = true
+		case "--oauth2-bearer":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			bearer = v
+		case "--aws-sigv4":
+			v, err := value(&i, flag, attached)
+			if err != nil {
+				return Request{}, err
+			}
+			awsSigV4 = v
+		case "--compressed":
+			compressed = true
+		case "-G", "--get":
+			getData = true
+		case "-I", "--head":
+			head = true
+		default:
+			// Output and connection flags such as -s, -L, -k or -o don't change
+			// the request. Skip the value of those that take one.
+			if curlTakesValue(flag) && attached == "" {
+				i++
+			}
+		}
+	}
+
+	if rawURL == "" {
+		return Request{}, fmt.Errorf("no URL found in curl command")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return Request{}, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	query := parseQuery(parsedURL.RawQuery)
+	body := strings.Join(data, "&")
+
+	if getData && body != "" {
+		if _, err := url.ParseQuery(body); err != nil {
+			return Request{}, fmt.Errorf("invalid data for -G: %w", err)
+		}
+		query = append(query, parseQuery(body)...)
+		body = ""
+	}
+
+	// The body type sets the Content-Type curl would have sent
+	bodyType := bodyNone
+	var form KeyValues
+	var bodyFile string
+	switch contentType := curlHeader(headers, "Content-Type"); {
+	case len(forms) > 0:
+		bodyType = bodyMultipart
+		for _, f := range forms {
+			row, err := formRow(f)
+			if err != nil {
+				return Request{}, err
+			}
+			form = append(form, row)
+		}
+		body = ""
+	case body == "":
+	case dataFile != "" && len(data) == 1:
+		// A file sent as it is stays a file, read again on each send
+		bodyType, bodyFile = bodyBinary, dataFile
+		body = ""
+	case strings.Contains(contentType, "json"):
+		bodyType = bodyJSON
+	case strings.Contains(contentType, "xml"):
+		bodyType = bodyXML
+	case contentType == "" || strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		// Only bodies that read back the same become form fields
+		if fields := parseQuery(body); encodeQuery(fields) == body {
+			bodyType, form = bodyForm, fields
+			body = ""
+			break
+		}
+		bodyType = bodyText
+		if contentType == "" {
+			headers = append(headers, [2]string{"Content-Type", "application/x-www-form-urlencoded"})
+		}
+	default:
+		bodyType = bodyText
+	}
+
+	var auth *Auth
+	switch {
+	case user != "":
+		username, password, _ := strings.Cut(user, ":")
+		auth = &Auth{Type: authBasic, Username: username, Password: password}
+		switch {
+		case digest:
+			auth.Type = authDigest
+		case awsSigV4 != "":
+			// The provider is given as aws:amz:region:service
+			provider := strings.Split(awsSigV4, ":")
+			auth = &Auth{Type: authAWSv4, AccessKey: username, SecretKey: password}
+			if len(provider) > 2 {
+				auth.Region = provider[2]
+			}
+			if len(provider) > 3 {
+				auth.Service = provider[3]
+			}
+		}
+	case bearer != "":
+		auth = &Auth{Type: authBearer, Token: bearer}
+	}
+	if len(cookies) > 0 {
+		headers = append(headers, [2]string{"Cookie", strings.Join(cookies, "; ")})
+	}
+	if compressed && !hasHeader(headers, "Accept-Encoding") {
+		headers = append(headers, [2]string{"Accept-Encoding", compressedEncodings})
+	}
+
+	switch {
+	case method != "":
+	case head:
+		method = "HEAD"
+	case bodyType != bodyNone:
+		method = "POST"
+	default:
+		method = "GET"
+	}
+
+	r := Request{
+		Method:   method,
+		Body:     body,
+		BodyType: bodyType,
+		Form:     form,
+		BodyFile: bodyFile,
+		Auth:     auth,
+	}
+
+	r.QueryParams = query
+	parsedURL.RawQuery = ""
+	r.URL = parsedURL.String()
+
+	for _, h := range headers {
+		r.Headers = append(r.Headers, KeyValue{Key: h[0], Value: h[1]})
+	}
+
+	r.Name = curlRequestName(method, parsedURL)
+	return r, nil
+}
+
+// curlTakesValue reports whether a curl flag consumes the following word.
+func curlTakesValue(flag string) bool {
+	switch flag {
+	case "-X", "--request", "--url", "-H", "--header", "-d", "--data", "--data-ascii",
+		"--data-binary", "--data-raw", "--data-urlencode", "--json", "-F", "--form", "--form-string",
+		"-u", "--user", "--oauth2-bearer", "--aws-sigv4", "-b", "--cookie", "-A", "--user-agent", "-e", "--referer",
+		"-o", "--output", "-c", "--cookie-jar", "-m", "--max-time", "--connect-timeout",
+		"-x", "--proxy", "-U", "--proxy-user", "-w", "--write-out", "-T", "--upload-file",
+		"-E", "--cert", "--key", "--cacert", "--capath", "-r", "--range", "--resolve",
+		"--retry", "-K", "--config", "--limit-rate", "-y", "--speed-time", "-Y", "--speed-limit",
+		"--max-redirs", "--interface", "--dns-servers", "--cert-type", "--key-type", "--pass":
+		return true
+	}
+	return false
+}
+
+func hasHeader(headers [][2]string, name string) bool {
+	for _, h := range headers {
+		if strings.EqualFold(h[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// curlHeader returns the last value given for a header, as curl sends it.
+func curlHeader(headers [][2]string, name string) string {
+	var value string
+	for _, h := range headers {
+		if strings.EqualFold(h[0], name) {
+			value = h[1]
+		}
+	}
+	return value
+}
+
+// curlURLEncode implements the forms accepted by --data-urlencode.
+func curlURLEncode(v string) (string, error) {
+	if name, content, ok := strings.Cut(v, "="); ok {
+		if name == "" {
+			return url.QueryEscape(content), nil
+		}
+		return name + "=" + url.QueryEscape(content), nil
+	}
+	if name, file, ok := strings.Cut(v, "@"); ok {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if name == "" {
+			return url.QueryEscape(string(content)), nil
+		}
+		return name + "=" + url.QueryEscape(string(content)), nil
+	}
+	return url.QueryEscape(v), nil
+}
+
+// formField is a -F argument. Values of --form-string are always literal.
+type formField struct {
+	value   string
+	literal bool
+}
+
+// formRow turns a -F argument into a multipart form row. "@file" uploads a
+// file and "<file" sends the text of one, read now as -d @file is; values of
+// --form-string are always text.
+func formRow(form formField) (KeyValue, error) {
+	name, value, ok := strings.Cut(form.value, "=")
+	if !ok {
+		return KeyValue{}, fmt.Errorf("invalid form field %q", form.value)
+	}
+	if form.literal {
+		return KeyValue{Key: name, Value: value}, nil
+	}
+
+	// Attributes such as ;type=image/png follow the value, the type of
+	// files is guessed again from their name when sent
+	value, _, _ = strings.Cut(value, ";")
+	switch {
+	case strings.HasPrefix(value, "@"):
+		return KeyValue{Key: name, Value: value[1:], Type: formFile}, nil
+	case strings.HasPrefix(value, "<"):
+		content, err := os.ReadFile(value[1:])
+		if err != nil {
+			return KeyValue{}, fmt.Errorf("failed to read %s: %w", value[1:], err)
+		}
+		return KeyValue{Key: name, Value: string(content)}, nil
+	}
+	return KeyValue{Key: name, Value: value}, nil
+}
+
+// curlRequestName names an imported request after its method and path,
+// within the limit of the name field.
+func curlRequestName(method string, u *url.URL) string {
+	name := method + " " + u.Host
+	if p := path.Clean("/" + u.Path); p != "/" {
+		name = method + " " + p
+	}
+	if runes := []rune(name); len(runes) > 22 {
+		name = string(runes[:21]) + "…"
+	}
+	return name
+}
+
+// splitShellWords splits a command line the way a POSIX shell would,
+// handling quotes, backslash escapes, line continuations and $'...' strings.
+func splitShellWords(s string) ([]string, error) {
+	var (
+		words   []string
+		current strings.Builder
+		inWord  bool
+	)
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				if runes[i] == '\n' || runes[i] == '\r' {
+					// Line continuation
+					if runes[i] == '\r' && i+1 < len(runes) && runes[i+1] == '\n' {
+						i++
+					}
+					continue
+				}
+				current.WriteRune(runes[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := indexRune(runes, '\'', i+1)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			current.WriteString(string(runes[i+1 : end]))
+			i = end
+			inWord = true
+		case c == '$' && i+1 < len(runes) && runes[i+1] == '\'':
+			i += 2
+			for ; i < len(runes) && runes[i] != '\''; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						current.WriteRune('\n')
+					case 't':
+						current.WriteRune('\t')
+					case 'r':
+						current.WriteRune('\r')
+					default:
+						current.WriteRune(runes[i])
+					}
+					continue
+				}
+				current.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated $' quote")
+			}
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				current.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+	return words, nil
+}
+
+func indexRune(runes []rune, r rune, from int) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// exportCurl renders a request as a curl command. Placeholders are resolved
+// from variables, or kept as {{key}} when keepPlaceholders is set so the
+// command can be shared without leaking secrets.
+func exportCurl(r Request, variables map[string]string, keepPlaceholders bool) (string, error) {
+	var sentinels map[string]string
+	if keepPlaceholders {
+		// Resolve each placeholder to a token that survives URL encoding, and
+		// put the placeholders back once the request is built.
+		variables = map[string]string{}
+		sentinels = map[string]string{}
+		for _, field := range requestTexts(r) {
+			for _, match := range placeholderRegexp.FindAllStringSubmatch(field, -1) {
+				if _, ok := variables[match[1]]; !ok {
+					token := fmt.Sprintf("gostmanplaceholder%dx", len(variables))
+					variables[match[1]] = token
+					sentinels[token] = match[0]
+				}
+			}
+		}
+	}
+
+	resolve := func(s string) string {
+		return replacePlaceholders(s, variables)
+	}
+
+	// Files are passed by name for curl to read when the command runs
+	built := r
+	var fileParts []string
+	switch r.BodyType {
+	case bodyMultipart:
+		// Text rows use --form-string, for which curl reads nothing into a
+		// leading @ or < or a ;type= in the value
+		for _, kv := range r.Form.resolved(resolve) {
+			if kv.Type == formFile {
+				fileParts = append(fileParts, "-F "+shellQuote(kv.Key+"=@"+kv.Value))
+				continue
+			}
+			fileParts = append(fileParts, "--form-string "+shellQuote(kv.Key+"="+kv.Value))
+		}
+		built.BodyType = bodyNone
+	case bodyBinary:
+		if path := strings.TrimSpace(resolve(r.BodyFile)); path != "" {
+			fileParts = append(fileParts, "--data-binary "+shellQuote("@"+path))
+			if _, ok := r.Headers.header("Content-Type"); !ok {
+				built.Headers = append(slices.Clone(r.Headers), KeyValue{Key: "Content-Type", Value: fileContentType(path)})
+			}
+		}
+		built.BodyType = bodyNone
+	}
+
+	// Credentials are passed with -u for curl to encode, which keeps
+	// placeholders in them readable
+	var userParts []string
+	if _, typed := r.Headers.header("Authorization"); !typed && r.Auth != nil && (r.Auth.Type == authBasic || r.Auth.Type == authDigest) {
+		if r.Auth.Type == authDigest {
+			userParts = append(userParts, "--digest")
+		}
+		userParts = append(userParts, "-u "+shellQuote(resolve(r.Auth.Username)+":"+resolve(r.Auth.Password)))
+		built.Auth = nil
+	}
+	if _, typed := r.Headers.header("Authorization"); !typed && r.Auth != nil && r.Auth.Type == authAWSv4 {
+		// curl signs the request itself when it runs, as a signature
+		// only holds for a few minutes
+		aws := *r.Auth
+		if keepPlaceholders {
+			aws = awsPlaceholders(aws)
+		}
+		aws = aws.resolved(resolve)
+		if !keepPlaceholders {
+			aws = awsFromEnvironment(aws)
+		}
+		provider := "aws:amz"
+		if aws.Region != "" {
+			provider += ":" + aws.Region
+			if aws.Service != "" {
+				provider += ":" + aws.Service
+			}
+		}
+		userParts = append(userParts, "--aws-sigv4 "+shellQuote(provider), "-u "+shellQuote(aws.AccessKey+":"+aws.SecretKey))
+		if aws.SessionToken != "" {
+			userParts = append(userParts, "-H "+shellQuote("X-Amz-Security-Token: "+aws.SessionToken))
+		}
+		built.Auth = nil
+	}
+
+	if !keepPlaceholders {
+		// Tokens are secrets, so only resolved commands carry them
+		built = withCachedToken(built, variables)
+	}
+
+	req, err := buildRequest(context.Background(), built, variables)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	var body string
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+		body = string(b)
+	}
+
+	switch {
+	case req.Method == "HEAD":
+		parts = append(parts, "--head")
+	case req.Method == "GET" && body == "" && len(fileParts) == 0:
+	default:
+		parts = append(parts, "-X "+shellQuote(req.Method))
+	}
+
+	parts = append(parts, shellQuote(req.URL.String()))
+
+	if req.Host != "" && req.Host != req.URL.Host {
+		parts = append(parts, "-H "+shellQuote("Host: "+req.Host))
+	}
+	compressed := false
+	for _, key := range headerOrder(built.Headers, req.Header) {
+		if key == "Accept-Encoding" && slices.Equal(req.Header[key], []string{compressedEncodings}) {
+			// The encodings --compressed asks for, which also has curl
+			// decompress the response
+			compressed = true
+			continue
+		}
+		for _, value := range req.Header[key] {
+			parts = append(parts, "-H "+shellQuote(key+": "+value))
+		}
+	}
+	if compressed {
+		parts = append(parts, "--compressed")
+	}
+
+	parts = append(parts, userParts...)
+	parts = append(parts, fileParts...)
+	if body != "" {
+		parts = append(parts, "--data-raw "+shellQuote(body))
+	}
+
+	command := "curl " + strings.Join(parts, " \\\n  ")
+	for token, placeholder := range sentinels {
+		command = strings.ReplaceAll(command, token, placeholder)
+	}
+	return command, nil
+}
+
+// headerOrder lists the names in header in the order of the request's rows,
+// followed by any others, such as ones added while sending, sorted.
+func headerOrder(rows KeyValues, header http.Header) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, kv := range rows.enabled() {
+		key := http.CanonicalHeaderKey(kv.Key)
+		if _, ok := header[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	var rest []string
+	for key := range header {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// shellQuote quotes s for POSIX shells, leaving simple words untouched.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_@%+=:,./-") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCurlForm(t *testing.T) {
+	r, err := parseCurl(`curl https://example.com/upload -F 'image=@/tmp/front.png;type=image/png' --form-string 'owner=@handle' -F 'title=Front'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := KeyValues{
+		{Key: "image", Value: "/tmp/front.png", Type: formFile},
+		{Key: "owner", Value: "@handle"},
+		{Key: "title", Value: "Front"},
+	}
+	if r.BodyType != bodyMultipart || !reflect.DeepEqual(r.Form, want) {
+		t.Errorf("body %q, form %+v", r.BodyType, r.Form)
+	}
+}
+
+func TestExportCurlForm(t *testing.T) {
+	r := Request{
+		Method:   "POST",
+		URL:      "https://example.com/upload",
+		BodyType: bodyMultipart,
+		Form: KeyValues{
+			{Key: "image", Value: "/tmp/front.png", Type: formFile},
+			{Key: "owner", Value: "@handle"},
+			{Key: "note", Value: "<not a file;type=x"},
+		},
+	}
+	command, err := exportCurl(r, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{"-F image=@/tmp/front.png", "--form-string owner=@handle", "--form-string 'note=<not a file;type=x'"} {
+		if !strings.Contains(command, part) {
+			t.Errorf("command lacks %s:\n%s", part, command)
+		}
+	}
+
+	// The command imports back to the same rows
+	imported, err := parseCurl(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(imported.Form, r.Form) {
+		t.Errorf("imported form = %+v, want %+v", imported.Form, r.Form)
+	}
+}
+
+func TestExportCurlCompressed(t *testing.T) {
+	r := Request{Method: "GET", URL: "https://example.com", Headers: createHeaders()}
+	command, err := exportCurl(r, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(command, "--compressed") || strings.Contains(command, "Accept-Encoding") {
+		t.Errorf("default encodings weren't exported as --compressed:\n%s", command)
+	}
+	imported, err := parseCurl(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := imported.Headers.header("Accept-Encoding"); v != compressedEncodings {
+		t.Errorf("imported Accept-Encoding = %q", v)
+	}
+
+	// Other encodings are kept as they were typed
+	r.Headers = KeyValues{{Key: "Accept-Encoding", Value: "identity"}}
+	command, err = exportCurl(r, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(command, "--compressed") || !strings.Contains(command, "-H 'Accept-Encoding: identity'") {
+		t.Errorf("command = %s", command)
+	}
+}
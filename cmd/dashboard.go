@@ -6,6 +6,7 @@ import (
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textarea"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -13,9 +14,16 @@ type listItem struct {
 	request Request
 }
 
-func (i listItem) Title() string       { return i.request.Name }
-func (i listItem) Description() string { return i.request.Method }
-func (i listItem) FilterValue() string { return i.request.Name }
+func (i listItem) Title() string { return i.request.Name }
+
+func (i listItem) Description() string {
+	if i.request.Folder != "" {
+		return i.request.Method + " · " + i.request.Folder
+	}
+	return i.request.Method
+}
+
+func (i listItem) FilterValue() string { return i.request.Folder + " " + i.request.Name }
 
 type board struct {
 	width       int
@@ -24,6 +32,10 @@ type board struct {
 	list        list.Model
 	returnModel *Model
 	showMsg     bool
+	// curl import dialog
+	importing  bool
+	importArea textarea.Model
+	message    string
 }
 
 func dashboard(width, height int, styles *Styles, returnModel *Model) board {
@@ -52,14 +64,20 @@ func dashboard(width, height int, styles *Styles, returnModel *Model) board {
 		list:        list.New(items, list.NewDefaultDelegate(), width, height-3),
 		returnModel: returnModel,
 		showMsg:     false,
+		importArea:  newTextarea(),
 	}
 
+	board.importArea.Placeholder = "curl -X POST https://api.example.com/login -H 'Content-Type: application/json' -d '{\"user\":\"me\"}'"
+	board.importArea.ShowLineNumbers = false
+
 	board.list.Title = "List of Requests "
 
 	board.list.AdditionalShortHelpKeys = func() []key.Binding {
 		return []key.Binding{
 			Keymap.Create,
 			Keymap.Delete,
+			Keymap.Import,
+			Keymap.Run,
 			Keymap.Back,
 		}
 	}
@@ -77,6 +95,28 @@ func (m board) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if msg.String() == "ctrl+c" {
 			return m, tea.Quit
 		}
+		if m.importing {
+			return m.updateImport(msg)
+		}
+		if msg.String() == "i" && !m.showMsg && m.list.FilterState() != list.Filtering {
+			m.importing = true
+			m.message = ""
+			m.importArea.Reset()
+			m.importArea.Focus()
+			return m, nil
+		}
+		if msg.String() == "r" && !m.showMsg && m.list.FilterState() != list.Filtering {
+			// Run the requests left by the filter, or all of them
+			var requests []Request
+			for _, item := range m.list.VisibleItems() {
+				requests = append(requests, item.(listItem).request)
+			}
+			if len(requests) == 0 {
+				m.message = "No requests to run"
+				return m, nil
+			}
+			return newCollectionRunner(m, requests)
+		}
 		if msg.String() == "esc" {
 			m.returnModel.height = m.height
 			m.returnModel.width = m.width
@@ -144,12 +184,58 @@ func (m board) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// updateImport handles keys while the curl import dialog is open.
+func (m board) updateImport(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.importing = false
+		m.message = ""
+		m.importArea.Blur()
+		return m, nil
+	case "ctrl+s":
+		request, err := parseCurl(m.importArea.Value())
+		if err != nil {
+			m.message = "Failed to import: " + err.Error()
+			return m, nil
+		}
+		request.Id = SaveRequests(request)
+		if request.Id == "" {
+			m.message = "Failed to save the imported request"
+			return m, nil
+		}
+
+		m.list.InsertItem(len(m.list.Items()), listItem{request: request})
+		m.list.Select(len(m.list.Items()) - 1)
+		m.importing = false
+		m.importArea.Blur()
+		m.message = "Imported " + request.Name
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.importArea, cmd = m.importArea.Update(msg)
+	return m, cmd
+}
+
 func (m board) View() string {
 	footer := m.appBoundaryMessage("Ctrl+c to quit, <ESC> to go back")
+	if m.message != "" {
+		footer = m.appBoundaryMessage(m.message)
+	}
 	if m.showMsg {
 		footer = m.appBoundaryMessage("Delete selected item? : (Y/N)")
 	}
 
+	if m.importing {
+		if m.message == "" {
+			footer = m.appBoundaryMessage("Ctrl+s to import, <ESC> to cancel")
+		}
+		m.importArea.SetWidth(m.width - 2)
+		m.importArea.SetHeight(m.height - 5)
+		body := borderStyle.Width(m.width - 2).Height(m.height - 3).Render(titleStyle.Render(" Paste a curl command ") + "\n" + m.importArea.View())
+		return m.styles.Base.Render(body + "\n" + footer)
+	}
+
 	body := borderStyle.Width(m.width - 2).Render(m.list.View())
 	return m.styles.Base.Render(body + "\n" + footer)
 }
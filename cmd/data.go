@@ -9,25 +9,49 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type SavedData struct {
-	Variables string    `json:"variables"`
-	Requests  []Request `json:"requests"`
+	Variables         string        `json:"variables"`
+	Environments      []Environment `json:"environments,omitempty"`
+	ActiveEnvironment string        `json:"activeEnvironment,omitempty"`
+	Settings          Settings      `json:"settings"`
+	HistoryLimit      int           `json:"historyLimit,omitempty"`
+	Requests          []Request     `json:"requests"`
+}
+
+// Environment is a named set of variables such as local, staging or prod.
+// While it is active its variables are layered over the global Variables.
+type Environment struct {
+	Name      string `json:"name"`
+	Variables string `json:"variables"`
 }
 
 // Request represents the structure of a single saved request
 type Request struct {
-	Id          string `json:"id"`
-	Name        string `json:"name"`
-	URL         string `json:"url"`
-	Method      string `json:"method"`
-	Headers     string `json:"headers"`
-	Body        string `json:"body"`
-	QueryParams string `json:"queryParams"`
-	Response    string `json:"response"`
+	Id          string    `json:"id"`
+	Name        string    `json:"name"`
+	Folder      string    `json:"folder,omitempty"`
+	URL         string    `json:"url"`
+	Method      string    `json:"method"`
+	Headers     KeyValues `json:"headers"`
+	Body        string    `json:"body"`
+	BodyType    string    `json:"bodyType,omitempty"` // see bodyTypes, "" for requests saved before them
+	Form        KeyValues `json:"form,omitempty"`     // fields of form and multipart bodies
+	BodyFile    string    `json:"bodyFile,omitempty"` // path of a binary body
+	QueryParams KeyValues `json:"queryParams"`
+	Auth        *Auth     `json:"auth,omitempty"`
+	Settings    string    `json:"settings,omitempty"`
+	Tests       string    `json:"tests,omitempty"`
+	Extract     string    `json:"extract,omitempty"`
+	PreScript   string    `json:"preScript,omitempty"`
+	PostScript  string    `json:"postScript,omitempty"`
+	Response    string    `json:"response"`
+	Timings     *Timings  `json:"timings,omitempty"`
 }
 
 var appFolder = getAppDataPath()
@@ -63,19 +87,21 @@ func getAppDataPath() string {
 	return filepath.Join(os.Getenv("HOME"), ".local", "share", "Gostman")
 }
 
-func SaveRequests(request Request) {
+// SaveRequests adds the request to the saved requests, or replaces the saved
+// request with the same Id, and returns its Id.
+func SaveRequests(request Request) string {
 
 	if checkFileExists(jsonfilePath) {
 
 		if err := os.MkdirAll(appFolder, os.ModePerm); err != nil {
 			fmt.Println("Failed to create directory:", err)
-			return
+			return ""
 		}
 
 		myfile, err := os.Create(jsonfilePath)
 		if err != nil {
 			fmt.Println("Failed to create file:", err)
-			return
+			return ""
 		}
 
 		defer myfile.Close()
@@ -117,30 +143,50 @@ func SaveRequests(request Request) {
 
 	if err := os.WriteFile(jsonfilePath, updatedData, 0644); err != nil {
 		fmt.Println("failed to add the request")
+		return ""
 	}
 
+	return request.Id
 }
 
-func save(m Model) {
-	// Example request data
-	request := Request{
+// request builds a Request from the current contents of the editor. The
+// query string of the URL field is kept in the Params tab, which it mirrors.
+func (m Model) request() Request {
+	base, _, fragment := splitURL(m.urlField.Value())
+	auth := m.auth
+	auth.setRows(m.authTable.Rows())
+	return Request{
 		Id:          m.id,
 		Name:        m.nameField.Value(),
-		URL:         m.urlField.Value(),
+		Folder:      m.folder,
+		URL:         base + fragment,
 		Method:      m.methodField.Value(),
-		Body:        m.tabContent[0].Value(),
-		QueryParams: m.tabContent[1].Value(),
-		Headers:     m.tabContent[2].Value(),
+		Body:        m.tabContent[bodyTab].Value(),
+		BodyType:    m.bodyType,
+		Form:        m.formTable.Rows(),
+		BodyFile:    m.tabContent[binaryContent].Value(),
+		QueryParams: m.paramsTable.Rows(),
+		Headers:     m.headersTable.Rows(),
+		Auth:        auth.saved(),
+		Settings:    m.tabContent[settingsTab].Value(),
+		Tests:       m.tabContent[testsTab].Value(),
+		Extract:     m.tabContent[extractTab].Value(),
+		PreScript:   m.tabContent[scriptsTab].Value(),
+		PostScript:  m.tabContent[postScriptContent].Value(),
 		Response:    m.response,
+		Timings:     m.timings,
 	}
-	SaveRequests(request)
+}
+
+func save(m Model) {
+	SaveRequests(m.request())
 }
 
 func load(data Request, model *Model) {
 
 	model.id = data.Id
 	model.nameField.SetValue(data.Name)
-	model.urlField.SetValue(data.URL)
+	model.folder = data.Folder
 	model.methodField.SetValue(data.Method)
 	// Sync methodIndex with loaded method if present
 	if len(model.methodOptions) == 0 {
@@ -152,13 +198,57 @@ func load(data Request, model *Model) {
 			break
 		}
 	}
-	model.tabContent[0].SetValue(data.Body)
-	model.tabContent[1].SetValue(data.QueryParams)
-	model.tabContent[2].SetValue(data.Headers)
+	model.tabContent[bodyTab].SetValue(data.Body)
+	model.bodyType = data.BodyType
+	if model.bodyType == "" {
+		model.bodyType = inferBodyType(data)
+	}
+	model.formTable.SetRows(data.Form)
+	model.tabContent[binaryContent].SetValue(data.BodyFile)
+	// A query string in the saved URL is sent before the params, so it
+	// becomes the first rows
+	base, query, fragment := splitURL(data.URL)
+	model.urlField.SetValue(base + fragment)
+	model.paramsTable.SetRows(append(parseQuery(query), data.QueryParams...))
+	model.syncURLFromParams()
+	model.headersTable.SetRows(data.Headers)
+	model.auth = Auth{Type: authNone}
+	if data.Auth != nil {
+		model.auth = *data.Auth
+	}
+	model.authTable.SetRows(model.auth.rows())
+	model.loadOAuthToken()
+	model.tabContent[settingsTab].SetValue(data.Settings)
+	model.tabContent[testsTab].SetValue(data.Tests)
+	model.tabContent[extractTab].SetValue(data.Extract)
+	model.tabContent[scriptsTab].SetValue(data.PreScript)
+	model.tabContent[postScriptContent].SetValue(data.PostScript)
 	model.response = data.Response
+	model.timings = data.Timings
 	model.responseViewport.SetContent(model.response)
 }
 
+// findRequest returns the saved request with the given Id or name.
+func findRequest(saved SavedData, nameOrID string) (Request, error) {
+	var matches []Request
+	for _, r := range saved.Requests {
+		if r.Id == nameOrID {
+			return r, nil
+		}
+		if r.Name == nameOrID {
+			matches = append(matches, r)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Request{}, fmt.Errorf("no saved request named %q", nameOrID)
+	case 1:
+		return matches[0], nil
+	default:
+		return Request{}, fmt.Errorf("%d saved requests are named %q, use the id instead", len(matches), nameOrID)
+	}
+}
+
 func delete(id string) error {
 
 	// Read the JSON file
@@ -206,51 +296,216 @@ func delete(id string) error {
 	return nil
 }
 
-func SaveVariables(variableString string) string {
+// SaveVariables stores the raw JSON variables of the named environment, or the
+// global variables when name is empty. A missing environment is created.
+func SaveVariables(name, variableString string) string {
 
-	if checkFileExists(jsonfilePath) {
+	var variables map[string]string
+	er := json.Unmarshal([]byte(variableString), &variables)
+	if er != nil {
+		return "Error parsing Environment Variables, JSON structure is incorrect"
+	}
 
-		if err := os.MkdirAll(appFolder, os.ModePerm); err != nil {
-			fmt.Println("Failed to create directory:", err)
+	err := updateSavedData(func(saved_data *SavedData) error {
+		if name == "" {
+			saved_data.Variables = variableString
+			return nil
+		}
+		for i, e := range saved_data.Environments {
+			if e.Name == name {
+				saved_data.Environments[i].Variables = variableString
+				return nil
+			}
+		}
+		saved_data.Environments = append(saved_data.Environments, Environment{Name: name, Variables: variableString})
+		return nil
+	})
+	if err != nil {
+		return "failed to save the variables: " + err.Error()
+	}
+
+	return "Environment Variables Saved Sucessfully"
+
+}
+
+// storeVariables sets values in the named environment, "" meaning the active
+// one, keeping its other variables. Without an active environment the values
+// go to the globals. It returns the label of the environment written.
+func storeVariables(name string, values map[string]string) (string, error) {
+	var label string
+	err := updateSavedData(func(saved_data *SavedData) error {
+		if name == "" {
+			name = saved_data.ActiveEnvironment
 		}
 
-		myfile, err := os.Create(jsonfilePath)
+		target := &saved_data.Variables
+		if name != "" {
+			env := saved_data.environment(name)
+			if env == nil {
+				return fmt.Errorf("environment not found: %s", name)
+			}
+			target = &env.Variables
+		}
+
+		variables, err := parseVariables(*target)
 		if err != nil {
-			fmt.Println("Failed to create file:", err)
+			return fmt.Errorf("%s variables: %w", environmentLabel(name), err)
+		}
+		for key, value := range values {
+			variables[key] = value
 		}
+		*target = indentJSON(variables)
+		label = environmentLabel(name)
+		return nil
+	})
+	return label, err
+}
 
-		defer myfile.Close()
+// setActiveEnvironment marks the named environment as active. An empty name
+// leaves only the global variables in effect.
+func setActiveEnvironment(name string) error {
+	return updateSavedData(func(saved_data *SavedData) error {
+		if name != "" && saved_data.environment(name) == nil {
+			return fmt.Errorf("environment not found: %s", name)
+		}
+		saved_data.ActiveEnvironment = name
+		return nil
+	})
+}
+
+func deleteEnvironment(name string) error {
+	return updateSavedData(func(saved_data *SavedData) error {
+		for i, e := range saved_data.Environments {
+			if e.Name == name {
+				saved_data.Environments = append(saved_data.Environments[:i], saved_data.Environments[i+1:]...)
+				if saved_data.ActiveEnvironment == name {
+					saved_data.ActiveEnvironment = ""
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("environment not found: %s", name)
+	})
+}
+
+// activeVariables caches the variables of the active environment for the
+// editor, which looks them up on every render. The data file is only read
+// again once it has changed.
+var activeVariables struct {
+	sync.Mutex
+	modTime   time.Time
+	size      int64
+	variables map[string]string
+}
+
+// currentVariables returns the globals overlaid with the active environment,
+// or none when they can't be parsed.
+func currentVariables() map[string]string {
+	var modTime time.Time
+	var size int64
+	if info, err := os.Stat(jsonfilePath); err == nil {
+		modTime, size = info.ModTime(), info.Size()
 	}
 
-	file, err := os.ReadFile(jsonfilePath)
+	activeVariables.Lock()
+	defer activeVariables.Unlock()
+	if activeVariables.variables != nil && modTime.Equal(activeVariables.modTime) && size == activeVariables.size {
+		return activeVariables.variables
+	}
 
+	variables, err := getSavedData().variables("")
 	if err != nil {
-		panic(err)
+		variables = map[string]string{}
 	}
+	activeVariables.modTime, activeVariables.size, activeVariables.variables = modTime, size, variables
+	return variables
+}
 
-	var saved_data SavedData
-	json.Unmarshal(file, &saved_data)
-
-	var variables map[string]string
-	er := json.Unmarshal([]byte(variableString), &variables)
-	if er != nil {
-		return "Error parsing Environment Variables, JSON structure is incorrect"
+// environment returns the named environment, or nil if there is none.
+func (s SavedData) environment(name string) *Environment {
+	for i := range s.Environments {
+		if s.Environments[i].Name == name {
+			return &s.Environments[i]
+		}
 	}
+	return nil
+}
 
-	saved_data.Variables = variableString
+// variables returns the global variables overlaid with those of the named
+// environment. An empty name uses the active environment.
+func (s SavedData) variables(name string) (map[string]string, error) {
+	variables, err := parseVariables(s.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("globals: %w", err)
+	}
 
-	updatedData, err := json.MarshalIndent(saved_data, "", " ")
+	if name == "" {
+		name = s.ActiveEnvironment
+		if name == "" || s.environment(name) == nil {
+			// No active environment, or it was removed by hand
+			return variables, nil
+		}
+	}
 
+	env := s.environment(name)
+	if env == nil {
+		return nil, fmt.Errorf("environment not found: %s", name)
+	}
+	overlay, err := parseVariables(env.Variables)
 	if err != nil {
-		log.Fatalf("Error encoding JSON data: %v", err)
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	for key, value := range overlay {
+		variables[key] = value
 	}
+	return variables, nil
+}
 
-	if err := os.WriteFile(jsonfilePath, updatedData, 0644); err != nil {
-		fmt.Println("failed to add the request")
+// parseVariables parses the raw JSON of a variables editor. An empty string
+// yields no variables.
+func parseVariables(raw string) (map[string]string, error) {
+	variables := make(map[string]string)
+	if strings.TrimSpace(raw) == "" { // "" is not valid string to unmarshal. occurs when user doesn't init any env vars.
+		return variables, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &variables); err != nil {
+		return nil, err
 	}
+	return variables, nil
+}
 
-	return "Environment Variables Saved Sucessfully"
+// updateSavedData applies fn to the saved data and writes the result back,
+// creating the data file if it doesn't exist yet. Nothing is written when fn
+// returns an error.
+func updateSavedData(fn func(*SavedData) error) error {
+	if err := os.MkdirAll(appFolder, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	var saved_data SavedData
+	file, err := os.ReadFile(jsonfilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(file) > 0 {
+		if err := json.Unmarshal(file, &saved_data); err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	}
+
+	if err := fn(&saved_data); err != nil {
+		return err
+	}
+
+	updatedData, err := json.MarshalIndent(saved_data, "", " ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
 
+	if err := os.WriteFile(jsonfilePath, updatedData, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
 }
 
 func checkFileExists(filepath string) bool {
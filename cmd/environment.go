@@ -1,18 +1,36 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-var footer string
+// globalsName labels the global variables, which sit underneath every
+// environment.
+const globalsName = "Globals"
+
+const envHelp = "Ctrl+s to save, Ctrl+o to activate, Ctrl+n new, Ctrl+x delete, <ESC> to go back"
 
 type env struct {
 	width       int
 	height      int
 	styles      *Styles
 	returnModel Model
-	content     textarea.Model
+	// names holds the environment shown by each tab; "" is the globals.
+	names         []string
+	contents      []textarea.Model
+	activeTab     int
+	active        string
+	prompt        textinput.Model
+	showPrompt    bool
+	confirmDelete bool
+	footer        string
 }
 
 func environment(board Model) env {
@@ -22,26 +40,47 @@ func environment(board Model) env {
 		height:      board.height,
 		styles:      board.styles,
 		returnModel: board,
-		content:     newTextarea(),
+		prompt:      textinput.New(),
 	}
 
-	env.content.SetValue(loadVariables())
-	env.content.SetWidth(env.width - 2)
-	env.content.SetHeight(env.height - 5)
-	env.content.Placeholder = `
-	{
-	"Key":"Value",
-}`
+	env.prompt.Prompt = "Name: "
+	env.prompt.Placeholder = "staging"
+	env.prompt.Cursor.Blink = false
 
-	footer = env.appBoundaryView("Ctrl+s to save variables, <ESC> to go back")
+	saved := getSavedData()
+	env.active = saved.ActiveEnvironment
+	env.addTab("", saved.Variables)
+	for _, e := range saved.Environments {
+		env.addTab(e.Name, e.Variables)
+		if e.Name == env.active {
+			env.activeTab = len(env.names) - 1
+		}
+	}
+
+	env.sizeInputs()
+	env.contents[env.activeTab].Focus()
+	env.footer = env.appBoundaryView(envHelp)
 
 	return env
 
 }
 
+func (en *env) addTab(name, variables string) {
+	content := newTextarea()
+	content.SetValue(variables)
+	content.Placeholder = `
+	{
+	"Key":"Value",
+}`
+	en.names = append(en.names, name)
+	en.contents = append(en.contents, content)
+}
+
 func (en *env) sizeInputs() {
-	en.content.SetWidth(en.width - 2)
-	en.content.SetHeight(en.height - 5)
+	for i := range en.contents {
+		en.contents[i].SetWidth(en.width - 2)
+		en.contents[i].SetHeight(en.height - 7)
+	}
 }
 
 func (en env) Init() tea.Cmd {
@@ -53,23 +92,111 @@ func (en env) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	var cmds []tea.Cmd
 
-	en.content.Focus()
-
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		if msg.String() == "ctrl+c" {
 			return en, tea.Quit
 		}
-		if msg.String() == "esc" {
+
+		if en.showPrompt {
+			switch msg.String() {
+			case "esc":
+				en.showPrompt = false
+				en.footer = en.appBoundaryView(envHelp)
+				return en, nil
+			case "enter":
+				name := strings.TrimSpace(en.prompt.Value())
+				if name == "" || strings.EqualFold(name, globalsName) {
+					en.footer = en.appBoundaryMessage("Pick another name for the environment")
+					return en, nil
+				}
+				for _, n := range en.names {
+					if n == name {
+						en.footer = en.appBoundaryMessage("Environment " + name + " already exists")
+						return en, nil
+					}
+				}
+				en.showPrompt = false
+				en.addTab(name, "{}")
+				en.activeTab = len(en.names) - 1
+				en.contents[en.activeTab].Focus()
+				en.sizeInputs()
+				en.footer = en.appBoundaryMessage(SaveVariables(name, "{}"))
+				return en, nil
+			}
+			en.prompt, cmd = en.prompt.Update(msg)
+			return en, cmd
+		}
+
+		if en.confirmDelete {
+			switch msg.String() {
+			case "y":
+				name := en.names[en.activeTab]
+				if err := deleteEnvironment(name); err != nil {
+					en.footer = en.appBoundaryMessage(err.Error())
+				} else {
+					en.names = append(en.names[:en.activeTab], en.names[en.activeTab+1:]...)
+					en.contents = append(en.contents[:en.activeTab], en.contents[en.activeTab+1:]...)
+					if en.active == name {
+						en.active = ""
+					}
+					en.activeTab = max(en.activeTab-1, 0)
+					en.contents[en.activeTab].Focus()
+					en.footer = en.appBoundaryMessage("Environment " + name + " deleted")
+				}
+				en.confirmDelete = false
+				return en, nil
+			case "n", "esc":
+				en.confirmDelete = false
+				en.footer = en.appBoundaryView(envHelp)
+				return en, nil
+			}
+			return en, nil
+		}
+
+		switch msg.String() {
+		case "esc":
 			en.returnModel.height = en.height
 			en.returnModel.width = en.width
+			en.returnModel.environment = en.active
 			return en.returnModel, nil
-		}
-		if msg.String() == "ctrl+s" {
-			message := SaveVariables(en.content.Value())
-			footer = en.appBoundaryMessage(message)
-		} else {
-			footer = en.appBoundaryView("Ctrl+s to Save, <ESC> to go back")
+		case "shift+right":
+			en.activeTab = min(en.activeTab+1, len(en.names)-1)
+			en.contents[en.activeTab].Focus()
+			return en, nil
+		case "shift+left":
+			en.activeTab = max(en.activeTab-1, 0)
+			en.contents[en.activeTab].Focus()
+			return en, nil
+		case "ctrl+s":
+			message := SaveVariables(en.names[en.activeTab], en.contents[en.activeTab].Value())
+			en.footer = en.appBoundaryMessage(message)
+			return en, nil
+		case "ctrl+o":
+			name := en.names[en.activeTab]
+			if err := setActiveEnvironment(name); err != nil {
+				en.footer = en.appBoundaryMessage(err.Error())
+				return en, nil
+			}
+			en.active = name
+			en.footer = en.appBoundaryMessage("Active environment: " + environmentLabel(name))
+			return en, nil
+		case "ctrl+n":
+			en.showPrompt = true
+			en.prompt.SetValue("")
+			en.prompt.Focus()
+			en.footer = en.appBoundaryView("Enter to create, <ESC> to cancel")
+			return en, nil
+		case "ctrl+x":
+			if en.names[en.activeTab] == "" {
+				en.footer = en.appBoundaryMessage("Globals can't be deleted")
+				return en, nil
+			}
+			en.confirmDelete = true
+			en.footer = en.appBoundaryMessage(fmt.Sprintf("Delete environment %s? : (Y/N)", en.names[en.activeTab]))
+			return en, nil
+		default:
+			en.footer = en.appBoundaryView(envHelp)
 		}
 
 	case tea.WindowSizeMsg:
@@ -79,7 +206,7 @@ func (en env) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	en.sizeInputs()
 
-	en.content, cmd = en.content.Update(msg)
+	en.contents[en.activeTab], cmd = en.contents[en.activeTab].Update(msg)
 	cmds = append(cmds, cmd)
 
 	return en, tea.Batch(cmds...)
@@ -89,6 +216,150 @@ func (en env) View() string {
 
 	header := en.appBoundaryView("Environment Varibales")
 
-	body := borderStyle.Width(en.width - 2).Height(en.height - 4).Render(en.content.View())
+	labels := make([]string, len(en.names))
+	for i, name := range en.names {
+		labels[i] = environmentLabel(name)
+		if name == en.active {
+			labels[i] = "● " + labels[i]
+		}
+	}
+	envTabRow := tabRow(labels, en.activeTab, en.width-2)
+
+	footer := en.footer
+	if en.showPrompt {
+		footer = en.prompt.View()
+	}
+
+	body := borderStyle.Width(en.width - 2).Height(en.height - 4).Render(envTabRow + "\n" + en.contents[en.activeTab].View())
 	return en.styles.Base.Render(header + "\n" + body + "\n" + footer)
 }
+
+// environmentLabel is the display name of an environment; "" is the globals.
+func environmentLabel(name string) string {
+	if name == "" {
+		return globalsName
+	}
+	return name
+}
+
+type envItem struct {
+	name   string
+	active bool
+}
+
+func (i envItem) Title() string {
+	if i.name == "" {
+		return "No Environment"
+	}
+	return i.name
+}
+
+func (i envItem) Description() string {
+	desc := "Globals and " + i.name + " variables"
+	if i.name == "" {
+		desc = "Globals only"
+	}
+	if i.active {
+		desc += " · active"
+	}
+	return desc
+}
+
+func (i envItem) FilterValue() string { return i.name }
+
+// envPicker is a quick switcher for the active environment.
+type envPicker struct {
+	width       int
+	height      int
+	styles      *Styles
+	list        list.Model
+	returnModel Model
+	message     string
+}
+
+func environmentPicker(board Model) envPicker {
+	saved := getSavedData()
+
+	items := []list.Item{envItem{name: "", active: saved.ActiveEnvironment == ""}}
+	selected := 0
+	for i, e := range saved.Environments {
+		items = append(items, envItem{name: e.Name, active: e.Name == saved.ActiveEnvironment})
+		if e.Name == saved.ActiveEnvironment {
+			selected = i + 1
+		}
+	}
+
+	picker := envPicker{
+		width:       board.width,
+		height:      board.height,
+		styles:      board.styles,
+		list:        list.New(items, list.NewDefaultDelegate(), board.width, board.height-3),
+		returnModel: board,
+	}
+	picker.list.Title = "Environments "
+	picker.list.Select(selected)
+	picker.list.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{
+			key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "activate")),
+			Keymap.Back,
+		}
+	}
+	return picker
+}
+
+func (m envPicker) Init() tea.Cmd {
+	return nil
+}
+
+func (m envPicker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.list.FilterState() != list.Filtering {
+			switch msg.String() {
+			case "esc":
+				if m.list.FilterState() == list.FilterApplied {
+					break
+				}
+				m.returnModel.height = m.height
+				m.returnModel.width = m.width
+				return m.returnModel, nil
+			case "enter":
+				item, ok := m.list.SelectedItem().(envItem)
+				if !ok {
+					return m, nil
+				}
+				if err := setActiveEnvironment(item.name); err != nil {
+					m.message = err.Error()
+					return m, nil
+				}
+				m.returnModel.height = m.height
+				m.returnModel.width = m.width
+				m.returnModel.environment = item.name
+				m.returnModel.loadOAuthToken()
+				m.returnModel.message = m.returnModel.appBoundaryMessage("Active environment: " + item.Title())
+				return m.returnModel, nil
+			}
+		}
+	case tea.WindowSizeMsg:
+		m.list.SetSize(msg.Width, msg.Height-3)
+		m.height = msg.Height
+		m.width = msg.Width
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m envPicker) View() string {
+	footer := m.appBoundaryMessage("Ctrl+c to quit, <ESC> to go back")
+	if m.message != "" {
+		footer = m.appBoundaryMessage(m.message)
+	}
+
+	body := borderStyle.Width(m.width - 2).Render(m.list.View())
+	return m.styles.Base.Render(body + "\n" + footer)
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const extractPlaceholder = `
+	write variables to set from the response
+
+{
+	"token": {"jsonPath": "$.access_token"},
+	"requestId": {"header": "X-Request-Id"},
+	"csrf": {"regex": "name=\"csrf\" value=\"([^\"]+)\""},
+	"session": {"cookie": "SESSION"}
+}`
+
+// Extraction reads one value out of a response. Exactly one field is set; a
+// regex yields its first group, or the whole match when it has none.
+type Extraction struct {
+	JSONPath string `json:"jsonPath,omitempty"`
+	Header   string `json:"header,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+	Cookie   string `json:"cookie,omitempty"`
+}
+
+// extractResult is the outcome of extracting one variable.
+type extractResult struct {
+	variable string
+	value    string
+	err      error
+}
+
+// parseExtractions parses the raw JSON of an Extract tab, which maps variable
+// names to the Extraction filling them.
+func parseExtractions(raw string) (map[string]Extraction, error) {
+	extractions := map[string]Extraction{}
+	if strings.TrimSpace(raw) == "" {
+		return extractions, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &extractions); err != nil {
+		return nil, err
+	}
+	for name, e := range extractions {
+		if err := e.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return extractions, nil
+}
+
+func (e Extraction) validate() error {
+	set := 0
+	for _, s := range []string{e.JSONPath, e.Header, e.Regex, e.Cookie} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("set exactly one of jsonPath, header, regex or cookie")
+	}
+	if e.JSONPath != "" {
+		if _, err := parseJSONPath(e.JSONPath); err != nil {
+			return err
+		}
+	}
+	if e.Regex != "" {
+		if _, err := regexp.Compile(e.Regex); err != nil {
+			return fmt.Errorf("regex: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e Extraction) extract(res result) (string, error) {
+	switch {
+	case e.JSONPath != "":
+		value, found, err := lookupJSON(res.body, e.JSONPath)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", fmt.Errorf("%s not found", e.JSONPath)
+		}
+		return jsonText(value), nil
+	case e.Header != "":
+		values := res.headers.Values(e.Header)
+		if len(values) == 0 {
+			return "", fmt.Errorf("header %s not found", e.Header)
+		}
+		return strings.Join(values, ", "), nil
+	case e.Regex != "":
+		match := regexp.MustCompile(e.Regex).FindStringSubmatch(res.body)
+		if match == nil {
+			return "", fmt.Errorf("no match for %s", e.Regex)
+		}
+		if len(match) > 1 {
+			return match[1], nil
+		}
+		return match[0], nil
+	default:
+		for _, c := range res.cookies {
+			if c.Name == e.Cookie {
+				return c.Value, nil
+			}
+		}
+		return "", fmt.Errorf("cookie %s not found", e.Cookie)
+	}
+}
+
+// extractVariables applies every extraction to a response, sorted by
+// variable name.
+func extractVariables(extractions map[string]Extraction, res result) []extractResult {
+	names := make([]string, 0, len(extractions))
+	for name := range extractions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]extractResult, 0, len(names))
+	for _, name := range names {
+		value, err := extractions[name].extract(res)
+		results = append(results, extractResult{variable: name, value: value, err: err})
+	}
+	return results
+}
+
+// extractedValues returns the variables that were extracted successfully.
+func extractedValues(results []extractResult) map[string]string {
+	values := make(map[string]string, len(results))
+	for _, r := range results {
+		if r.err == nil {
+			values[r.variable] = r.value
+		}
+	}
+	return values
+}
+
+// extractSummary names the variables set from a response and where they
+// went, as in "set token, csrf in staging".
+func extractSummary(res result) string {
+	var set, failed []string
+	for _, r := range res.extracted {
+		if r.err == nil {
+			set = append(set, r.variable)
+		} else {
+			failed = append(failed, r.variable)
+		}
+	}
+
+	var parts []string
+	if len(set) > 0 {
+		parts = append(parts, "set "+strings.Join(set, ", ")+" in "+res.extractedTo)
+	}
+	if len(failed) > 0 {
+		parts = append(parts, "couldn't set "+strings.Join(failed, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseExtractions(t *testing.T) {
+	extractions, err := parseExtractions(`{"token": {"jsonPath": "$.access_token"}, "id": {"header": "X-Id"}, "csrf": {"regex": "csrf=(\\w+)"}, "session": {"cookie": "SESSION"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extractions) != 4 || extractions["token"].JSONPath != "$.access_token" || extractions["session"].Cookie != "SESSION" {
+		t.Errorf("extractions = %+v", extractions)
+	}
+	if extractions, err := parseExtractions(" \n"); err != nil || len(extractions) != 0 {
+		t.Errorf("empty tab = %+v, %v", extractions, err)
+	}
+
+	for raw, wantErr := range map[string]string{
+		`{"token": {}}`: "token: set exactly one of",
+		`{"token": {"jsonPath": "$.a", "header": "X-A"}}`: "token: set exactly one of",
+		`{"token": {"jsonPath": "$.a[x]"}}`:               "bad index",
+		`{"token": {"regex": "("}}`:                       "token: regex:",
+		`[{"jsonPath": "$.a"}]`:                           "cannot unmarshal",
+	} {
+		if _, err := parseExtractions(raw); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: err = %v, want %q", raw, err, wantErr)
+		}
+	}
+}
+
+func TestExtractVariables(t *testing.T) {
+	res := result{
+		statusCode: 200,
+		body:       `{"access_token": "abc", "user": {"id": 42, "roles": ["admin"]}, "items": [{"id": "first"}, {"id": "last"}]} <input name="csrf" value="c5rf">`,
+		headers:    http.Header{"X-Request-Id": {"req-1"}, "Vary": {"Accept", "Origin"}},
+		cookies:    []*http.Cookie{{Name: "SESSION", Value: "s1"}, {Name: "theme", Value: "dark"}},
+	}
+	// The body isn't JSON with the form after it, so JSON lookups get a
+	// body of their own
+	jsonRes := res
+	jsonRes.body = res.body[:strings.LastIndex(res.body, "}")+1]
+
+	tests := []struct {
+		extraction Extraction
+		res        result
+		want       string
+		wantErr    string
+	}{
+		{Extraction{JSONPath: "$.access_token"}, jsonRes, "abc", ""},
+		{Extraction{JSONPath: "user.id"}, jsonRes, "42", ""},
+		{Extraction{JSONPath: "$.user.roles"}, jsonRes, `["admin"]`, ""},
+		{Extraction{JSONPath: "$.user"}, jsonRes, `{"id":42,"roles":["admin"]}`, ""},
+		{Extraction{JSONPath: "$.items[-1].id"}, jsonRes, "last", ""},
+		{Extraction{JSONPath: "$.missing"}, jsonRes, "", "$.missing not found"},
+		{Extraction{JSONPath: "$.access_token"}, res, "", "JSON"},
+		{Extraction{Header: "x-request-id"}, res, "req-1", ""},
+		{Extraction{Header: "Vary"}, res, "Accept, Origin", ""},
+		{Extraction{Header: "X-Missing"}, res, "", "header X-Missing not found"},
+		{Extraction{Regex: `name="csrf" value="([^"]+)"`}, res, "c5rf", ""},
+		{Extraction{Regex: `c5\w+`}, res, "c5rf", ""},
+		{Extraction{Regex: `nope(\d+)`}, res, "", "no match for nope(\\d+)"},
+		{Extraction{Cookie: "SESSION"}, res, "s1", ""},
+		{Extraction{Cookie: "session"}, res, "", "cookie session not found"},
+	}
+	for _, tt := range tests {
+		got, err := tt.extraction.extract(tt.res)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%+v: err = %v, want %q", tt.extraction, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%+v = %q, %v, want %q", tt.extraction, got, err, tt.want)
+		}
+	}
+
+	results := extractVariables(map[string]Extraction{
+		"token":   {JSONPath: "$.access_token"},
+		"missing": {Header: "X-Missing"},
+		"session": {Cookie: "SESSION"},
+	}, jsonRes)
+	var names []string
+	for _, r := range results {
+		names = append(names, r.variable)
+	}
+	if strings.Join(names, ",") != "missing,session,token" {
+		t.Errorf("results in the order %v, want them sorted", names)
+	}
+	values := extractedValues(results)
+	if len(values) != 2 || values["token"] != "abc" || values["session"] != "s1" {
+		t.Errorf("values = %v", values)
+	}
+	if summary := extractSummary(result{extracted: results, extractedTo: "staging"}); summary != "set session, token in staging; couldn't set missing" {
+		t.Errorf("summary = %q", summary)
+	}
+}
+
+func TestStoreVariables(t *testing.T) {
+	useTempData(t)
+	err := updateSavedData(func(saved *SavedData) error {
+		saved.Variables = `{"host": "example.com"}`
+		saved.Environments = []Environment{{Name: "staging", Variables: `{"token": "old"}`}, {Name: "broken", Variables: `{`}}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without an active environment the globals are updated
+	label, err := storeVariables("", map[string]string{"token": "global"})
+	if err != nil || label != globalsName {
+		t.Fatalf("label %q, err %v", label, err)
+	}
+	if err := setActiveEnvironment("staging"); err != nil {
+		t.Fatal(err)
+	}
+	// and otherwise the active one, keeping the variables already there
+	label, err = storeVariables("", map[string]string{"token": "new", "id": "42"})
+	if err != nil || label != "staging" {
+		t.Fatalf("label %q, err %v", label, err)
+	}
+
+	saved := getSavedData()
+	globals, _ := parseVariables(saved.Variables)
+	if len(globals) != 2 || globals["host"] != "example.com" || globals["token"] != "global" {
+		t.Errorf("globals = %v", globals)
+	}
+	staging, _ := parseVariables(saved.environment("staging").Variables)
+	if len(staging) != 2 || staging["token"] != "new" || staging["id"] != "42" {
+		t.Errorf("staging = %v", staging)
+	}
+
+	if _, err := storeVariables("prod", map[string]string{"a": "1"}); err == nil || !strings.Contains(err.Error(), "environment not found: prod") {
+		t.Errorf("storing in a missing environment: %v", err)
+	}
+	if _, err := storeVariables("broken", map[string]string{"a": "1"}); err == nil || !strings.HasPrefix(err.Error(), "broken variables:") {
+		t.Errorf("storing in broken variables: %v", err)
+	}
+	if broken := getSavedData().environment("broken").Variables; broken != `{` {
+		t.Errorf("broken variables were rewritten as %q", broken)
+	}
+}
+
+func TestChainedRequests(t *testing.T) {
+	useTempData(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "SESSION", Value: "s1"})
+			w.Header().Set("X-Request-Id", "req-1")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token": "abc123", "expires_in": 3600}`))
+		case "/me":
+			session, _ := r.Cookie("SESSION")
+			if r.Header.Get("Authorization") != "Bearer abc123" || session == nil || session.Value != "s1" || r.Header.Get("X-Parent") != "req-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"name": "Ada"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	login := Request{
+		Method:  "POST",
+		URL:     server.URL + "/login",
+		Extract: `{"token": {"jsonPath": "$.access_token"}, "session": {"cookie": "SESSION"}, "parent": {"header": "X-Request-Id"}, "ttl": {"regex": "\"expires_in\":\\s*(\\d+)"}}`,
+	}
+	variables := map[string]string{}
+	res := execute(context.Background(), login, "", variables)
+	if res.statusCode != http.StatusOK {
+		t.Fatalf("login: status %q", res.status)
+	}
+	if summary := extractSummary(res); summary != "set parent, session, token, ttl in "+globalsName {
+		t.Errorf("login summary = %q", summary)
+	}
+	if variables["token"] != "abc123" || variables["ttl"] != "3600" {
+		t.Errorf("variables after login = %v", variables)
+	}
+
+	// A later request reads them back from the saved variables
+	saved, err := getSavedData().variables("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	me := Request{
+		Method:  "GET",
+		URL:     server.URL + "/me",
+		Headers: KeyValues{{Key: "Cookie", Value: "SESSION={{session}}"}, {Key: "X-Parent", Value: "{{parent}}"}},
+		Auth:    &Auth{Type: authBearer, Token: "{{token}}"},
+		Extract: `{"name": {"jsonPath": "$.name"}}`,
+	}
+	res = execute(context.Background(), me, "", saved)
+	if res.statusCode != http.StatusOK {
+		t.Fatalf("me: status %q, the token wasn't sent", res.status)
+	}
+	if saved["name"] != "Ada" {
+		t.Errorf("name = %q", saved["name"])
+	}
+
+	// Failed responses don't overwrite what was extracted before
+	missing := Request{Method: "GET", URL: server.URL + "/missing", Extract: `{"token": {"regex": ".*"}}`}
+	if res := execute(context.Background(), missing, "", saved); res.statusCode != http.StatusNotFound || len(res.extracted) != 0 {
+		t.Errorf("status %q, extracted %+v", res.status, res.extracted)
+	}
+	stored, _ := getSavedData().variables("")
+	if stored["token"] != "abc123" || stored["name"] != "Ada" {
+		t.Errorf("saved variables after a 404 = %v", stored)
+	}
+}
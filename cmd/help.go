@@ -11,11 +11,25 @@ import (
 const commandsContent = `tab = Move Around
 shift + tab = Move Backwards
 enter = Send Request
+esc = Cancel the running Request
+ctrl + t = Switch between the Pre-script and Post-script
+ctrl + t in Params/Headers/Form Body = Enable or disable the row
+ctrl + t in Body outside a form table = Change the body type
+ctrl + t in Auth = Change the auth type
+ctrl + x in Auth = Forget the cached OAuth 2.0 token
+ctrl + x in Params/Headers = Delete the row
+ctrl + f in a Multipart Body = Switch the row between text and a file
+enter in Params/Headers = Move to the next cell
 ctrl + s = Save Request								
-shift + Arrow Keys = Change Tabs (Body/Param/Header)
+shift + Arrow Keys = Change Tabs (Body/Params/Headers/Auth/Settings/Tests/Extract/Pre-script)
+ctrl + Arrow Keys = Change Response Tabs (Body/Headers/Cookies/Info/Tests/Console)
 ctrl + e = Open Environment Variables page
+ctrl + o = Switch the active Environment
 ctrl + d = Open dashboard
+ctrl + r = Open request history
 ctrl + y = Copy Response to Clipboard
+ctrl + g = Copy Request as curl command
+alt + g = Copy Request as curl command keeping {{placeholders}}
 ctrl + f = Auto-complete Name/URL from history
 up/down on Method = Cycle HTTP method
 ctrl + c = Quit`
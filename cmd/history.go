@@ -0,0 +1,552 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/uuid"
+)
+
+// HistoryEntry is a single executed request as it went over the wire, with
+// placeholders resolved, together with the response it received.
+type HistoryEntry struct {
+	Id         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Request    Request   `json:"request"`
+	Status     string    `json:"status"`
+	StatusCode int       `json:"statusCode"`
+	Timings    *Timings  `json:"timings,omitempty"`
+	Response   string    `json:"response"`
+}
+
+// defaultHistoryLimit caps the history when SavedData.HistoryLimit is unset.
+const defaultHistoryLimit = 500
+
+var historyFilePath = filepath.Join(appFolder, "history.jsonl")
+
+// historyMu serialises access to the history file.
+var historyMu sync.Mutex
+
+// historyCount is the number of entries in the history file, counted when
+// the first request is recorded and -1 until then.
+var historyCount = -1
+
+// redacted takes the place of credentials in the history.
+const redacted = "[redacted]"
+
+// recordHistory appends a sent request and its result to the history file.
+// History is best effort: failures to write it never affect the send.
+// Credentials are left out, as the file keeps every request.
+func recordHistory(r Request, req *http.Request, res result, variables map[string]string) {
+	secret := map[string]bool{
+		"Authorization":        true,
+		"Proxy-Authorization":  true,
+		"Cookie":               true,
+		"X-Amz-Security-Token": true,
+	}
+	var apiKey *Auth
+	if r.Auth != nil && r.Auth.Type == authAPIKey {
+		a := r.Auth.resolved(func(s string) string {
+			resolved, _ := resolvePlaceholders(s, variables)
+			return resolved
+		})
+		apiKey = &a
+		if in := strings.ToLower(strings.TrimSpace(a.In)); in == "header" || in == "" {
+			secret[http.CanonicalHeaderKey(strings.TrimSpace(a.Key))] = true
+		}
+	}
+
+	var headers KeyValues
+	if req.Host != "" && req.Host != req.URL.Host {
+		headers = append(headers, KeyValue{Key: "Host", Value: req.Host})
+	}
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range req.Header[key] {
+			if secret[key] {
+				value = redacted
+			}
+			headers = append(headers, KeyValue{Key: key, Value: value})
+		}
+	}
+
+	u := *req.URL
+	if apiKey != nil && strings.EqualFold(strings.TrimSpace(apiKey.In), "query") {
+		params := parseQuery(u.RawQuery)
+		for i := range params {
+			if params[i].Key == apiKey.Key {
+				params[i].Value = redacted
+			}
+		}
+		u.RawQuery = encodeQuery(params)
+	}
+
+	// Digest auth is kept so a re-opened entry answers challenges, but
+	// without its password
+	auth := digestAuth(req)
+	if auth != nil {
+		auth.Password = ""
+	}
+
+	var body string
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			body = string(b)
+		}
+	}
+
+	entry := HistoryEntry{
+		Id:   uuid.New().String(),
+		Time: time.Now(),
+		Request: Request{
+			Name:     r.Name,
+			URL:      u.String(),
+			Method:   req.Method,
+			Headers:  headers,
+			Body:     body,
+			Settings: redactSettings(r.Settings),
+			Auth:     auth,
+		},
+		Status:     res.status,
+		StatusCode: res.statusCode,
+		Timings:    res.timings,
+		Response:   res.body,
+	}
+
+	limit := getSavedData().HistoryLimit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	count, err := appendHistory(entry)
+	if err != nil {
+		return
+	}
+	if count > limit {
+		_, _ = pruneHistory(limit, 0)
+	}
+}
+
+// appendHistory adds an entry to the history file and returns how many it
+// holds. The file holds responses and request bodies, so only its owner can
+// read it.
+// redactSettings blanks the PKCS#12 password and the credentials of the
+// proxy URL in the raw JSON of a Settings tab, leaving the rest as it is.
+func redactSettings(raw string) string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal([]byte(raw), &fields) != nil {
+		return raw
+	}
+	changed := false
+	if _, ok := fields["pkcs12Password"]; ok {
+		fields["pkcs12Password"] = json.RawMessage(`""`)
+		changed = true
+	}
+	var proxy string
+	if json.Unmarshal(fields["proxy"], &proxy) == nil {
+		// The user info sits between the scheme and the host, and may
+		// hold {{placeholders}} that keep it from parsing as a URL
+		if scheme, rest, ok := strings.Cut(proxy, "://"); ok {
+			host, _, _ := strings.Cut(rest, "/")
+			if at := strings.LastIndex(host, "@"); at >= 0 {
+				fields["proxy"], _ = json.Marshal(scheme + "://" + rest[at+1:])
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return raw
+	}
+	redacted, err := json.MarshalIndent(fields, "", "\t")
+	if err != nil {
+		return ""
+	}
+	return string(redacted)
+}
+
+func appendHistory(entry HistoryEntry) (int, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	if err := os.MkdirAll(appFolder, os.ModePerm); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode history entry: %w", err)
+	}
+
+	if historyCount < 0 {
+		// Files written by older versions were readable by everyone
+		entries, _ := readHistory()
+		historyCount = len(entries)
+		_ = os.Chmod(historyFilePath, 0600)
+	}
+
+	file, err := os.OpenFile(historyFilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	historyCount++
+	return historyCount, nil
+}
+
+// loadHistory returns every history entry, oldest first. Lines that cannot be
+// parsed are skipped.
+func loadHistory() ([]HistoryEntry, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	return readHistory()
+}
+
+func readHistory() ([]HistoryEntry, error) {
+	file, err := os.Open(historyFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var entry HistoryEntry
+			if json.Unmarshal(line, &entry) == nil {
+				entries = append(entries, entry)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, fmt.Errorf("failed to read history: %w", err)
+		}
+	}
+	return entries, nil
+}
+
+// pruneHistory keeps at most keep of the newest entries (0 means no limit) and
+// drops entries older than maxAge (0 means no limit). It returns how many
+// entries were removed.
+func pruneHistory(keep int, maxAge time.Duration) (int, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	entries, err := readHistory()
+	if err != nil {
+		return 0, err
+	}
+
+	kept := entries
+	if maxAge > 0 {
+		cutoff := time.Now().Add(-maxAge)
+		kept = kept[:0:0]
+		for _, e := range entries {
+			if e.Time.After(cutoff) {
+				kept = append(kept, e)
+			}
+		}
+	}
+	if keep > 0 && len(kept) > keep {
+		kept = kept[len(kept)-keep:]
+	}
+
+	historyCount = len(entries)
+	removed := len(entries) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	var b strings.Builder
+	for _, e := range kept {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode history entry: %w", err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+
+	if err := os.WriteFile(historyFilePath, []byte(b.String()), 0600); err != nil {
+		return 0, fmt.Errorf("failed to write history: %w", err)
+	}
+	historyCount = len(kept)
+	return removed, nil
+}
+
+// parsePrune reads a prune rule typed into the history screen: a plain number
+// keeps that many of the newest entries, while a duration such as "72h" or
+// "30d" drops entries older than it.
+func parsePrune(input string) (int, time.Duration, error) {
+	input = strings.TrimSpace(input)
+	if n, err := strconv.Atoi(input); err == nil {
+		if n <= 0 {
+			return 0, 0, fmt.Errorf("count must be positive")
+		}
+		return n, 0, nil
+	}
+	if days, ok := strings.CutSuffix(input, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid age %q", input)
+		}
+		return 0, time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(input)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("invalid age %q", input)
+	}
+	return 0, d, nil
+}
+
+type historyItem struct {
+	entry HistoryEntry
+}
+
+func (i historyItem) Title() string {
+	return i.entry.Request.Method + " " + i.entry.Request.URL
+}
+
+func (i historyItem) Description() string {
+	desc := strings.TrimSpace(i.entry.Status)
+	if i.entry.Timings != nil {
+		desc += " · " + formatDuration(i.entry.Timings.Total)
+	}
+	return desc + " · " + i.entry.Time.Format("2006-01-02 15:04:05")
+}
+
+func (i historyItem) FilterValue() string {
+	return strings.Join([]string{
+		strconv.Itoa(i.entry.StatusCode),
+		i.entry.Status,
+		i.entry.Request.Method,
+		i.entry.Request.URL,
+		i.entry.Time.Format("2006-01-02 15:04:05"),
+	}, " ")
+}
+
+// filterHistory matches entries containing every space separated term, so
+// "404 /users 2024-05" narrows by status, URL and date at once.
+func filterHistory(term string, targets []string) []list.Rank {
+	terms := strings.Fields(strings.ToLower(term))
+	var ranks []list.Rank
+	for i, target := range targets {
+		lower := strings.ToLower(target)
+		var matched []int
+		ok := true
+		for _, t := range terms {
+			at := strings.Index(lower, t)
+			if at < 0 {
+				ok = false
+				break
+			}
+			for j := range len([]rune(t)) {
+				matched = append(matched, len([]rune(lower[:at]))+j)
+			}
+		}
+		if ok {
+			ranks = append(ranks, list.Rank{Index: i, MatchedIndexes: matched})
+		}
+	}
+	return ranks
+}
+
+var historyKeys = struct {
+	Open  key.Binding
+	Prune key.Binding
+}{
+	Open: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "open"),
+	),
+	Prune: key.NewBinding(
+		key.WithKeys("p"),
+		key.WithHelp("p", "prune"),
+	),
+}
+
+type historyBoard struct {
+	width       int
+	height      int
+	styles      *Styles
+	list        list.Model
+	returnModel *Model
+	prompt      textinput.Model
+	showPrompt  bool
+	message     string
+}
+
+func history(width, height int, styles *Styles, returnModel *Model) historyBoard {
+	h := historyBoard{
+		width:       width,
+		height:      height,
+		styles:      styles,
+		list:        list.New(nil, list.NewDefaultDelegate(), width, height-3),
+		returnModel: returnModel,
+		prompt:      textinput.New(),
+	}
+
+	h.list.Title = "History "
+	h.list.Filter = filterHistory
+	h.list.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{
+			historyKeys.Open,
+			historyKeys.Prune,
+			Keymap.Back,
+		}
+	}
+
+	h.prompt.Placeholder = "100 keeps the newest 100, 30d or 72h drops older entries"
+	h.prompt.Prompt = "Prune: "
+	h.prompt.Cursor.Blink = false
+
+	h.reload()
+	return h
+}
+
+// reload refreshes the list from the history file, newest first.
+func (m *historyBoard) reload() {
+	entries, err := loadHistory()
+	if err != nil {
+		m.message = err.Error()
+	}
+
+	items := make([]list.Item, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		items = append(items, historyItem{entry: entries[i]})
+	}
+	m.list.SetItems(items)
+}
+
+func (m historyBoard) Init() tea.Cmd {
+	return nil
+}
+
+func (m historyBoard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+
+		if m.showPrompt {
+			switch msg.String() {
+			case "esc":
+				m.showPrompt = false
+				m.prompt.Blur()
+				return m, nil
+			case "enter":
+				m.showPrompt = false
+				m.prompt.Blur()
+				keep, age, err := parsePrune(m.prompt.Value())
+				if err != nil {
+					m.message = err.Error()
+					return m, nil
+				}
+				removed, err := pruneHistory(keep, age)
+				if err != nil {
+					m.message = err.Error()
+					return m, nil
+				}
+				m.message = fmt.Sprintf("Pruned %d entries", removed)
+				m.reload()
+				return m, nil
+			}
+			var cmd tea.Cmd
+			m.prompt, cmd = m.prompt.Update(msg)
+			return m, cmd
+		}
+
+		// Let the list handle keys while its filter is being typed
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+
+		switch msg.String() {
+		case "esc":
+			if m.list.FilterState() == list.FilterApplied {
+				break
+			}
+			m.returnModel.height = m.height
+			m.returnModel.width = m.width
+			return m.returnModel, nil
+		case "enter":
+			item, ok := m.list.SelectedItem().(historyItem)
+			if !ok {
+				return m, nil
+			}
+			newModel := NewModel()
+			// Re-opened entries start as new requests so saving them never
+			// overwrites the saved request with resolved values.
+			load(item.entry.Request, &newModel)
+			newModel.width = m.width
+			newModel.height = m.height
+			newModel.styles = m.styles
+			newModel.response = formatJSON(item.entry.Response)
+			newModel.status = item.entry.Status
+			newModel.timings = item.entry.Timings
+			newModel.sizeInputs()
+			newModel.apiResponse = newModel.response
+			newModel.refreshResponse()
+			return newModel, nil
+		case "p":
+			m.showPrompt = true
+			m.prompt.SetValue("")
+			m.prompt.Focus()
+			return m, nil
+		}
+
+	case tea.WindowSizeMsg:
+		m.list.SetSize(msg.Width, msg.Height-3)
+		m.height = msg.Height
+		m.width = msg.Width
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m historyBoard) View() string {
+	footer := m.appBoundaryMessage("Ctrl+c to quit, / to filter, <ESC> to go back")
+	if m.message != "" {
+		footer = m.appBoundaryMessage(m.message)
+	}
+	if m.showPrompt {
+		footer = m.prompt.View()
+	}
+
+	body := borderStyle.Width(m.width - 2).Render(m.list.View())
+	return m.styles.Base.Render(body + "\n" + footer)
+}
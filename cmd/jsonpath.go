@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathSegment is one step of a JSON path: an object key or, when index
+// is set, an array index.
+type jsonPathSegment struct {
+	key   string
+	index *int
+}
+
+// parseJSONPath reads paths such as "$.data.items[0].id", "data.items[-1]" or
+// `$["odd.key"]`. The leading "$" is optional and negative indexes count
+// from the end of an array.
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	rest := strings.TrimSpace(path)
+	rest = strings.TrimPrefix(rest, "$")
+
+	var segments []jsonPathSegment
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: empty key", path)
+			}
+			segments = append(segments, jsonPathSegment{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: missing ]", path)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, jsonPathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			n, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON path %q: bad index %q", path, inner)
+			}
+			segments = append(segments, jsonPathSegment{index: &n})
+		default:
+			// A path may start with a bare key, as in "data.id"
+			rest = "." + rest
+		}
+	}
+	return segments, nil
+}
+
+// lookupJSON returns the value found at path in the JSON document body, and
+// whether it exists.
+func lookupJSON(body, path string) (any, bool, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var doc any
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		return nil, false, fmt.Errorf("response body is not JSON")
+	}
+
+	current := doc
+	for _, s := range segments {
+		if s.index != nil {
+			items, ok := current.([]any)
+			if !ok {
+				return nil, false, nil
+			}
+			i := *s.index
+			if i < 0 {
+				i += len(items)
+			}
+			if i < 0 || i >= len(items) {
+				return nil, false, nil
+			}
+			current = items[i]
+			continue
+		}
+
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false, nil
+		}
+		current, ok = object[s.key]
+		if !ok {
+			return nil, false, nil
+		}
+	}
+	return current, true, nil
+}
+
+// jsonText renders a JSON value compactly, leaving strings unquoted.
+func jsonText(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// KeyValue is a row of the Headers or Params table. Rows are kept in order
+// and keys may repeat, as in ?id=1&id=2.
+type KeyValue struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Disabled    bool   `json:"disabled,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Type is formFile for multipart form rows whose value is the path of
+	// a file to upload, and empty for rows sent as text
+	Type string `json:"type,omitempty"`
+	// KeyOnly marks a query param typed without "=", as in ?flag, which is
+	// written the same way while its value stays empty
+	KeyOnly bool `json:"keyOnly,omitempty"`
+}
+
+// KeyValues holds the headers or query params of a request.
+type KeyValues []KeyValue
+
+// UnmarshalJSON reads rows, and also the JSON object text that older versions
+// stored, such as "{\"Accept\": \"*/*\"}".
+func (kvs *KeyValues) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		var raw string
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		rows, err := parseKeyValues(raw)
+		if err != nil {
+			// Keep what was typed so a broken tab doesn't lose the whole file
+			rows = KeyValues{{Value: raw, Disabled: true, Description: "couldn't be read: " + err.Error()}}
+		}
+		*kvs = rows
+		return nil
+	}
+
+	var rows []KeyValue
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return err
+	}
+	*kvs = rows
+	return nil
+}
+
+// parseKeyValues reads a JSON object into rows, keeping the order and any
+// repeated keys of the text. Values that aren't strings keep their JSON form.
+func parseKeyValues(raw string) (KeyValues, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(raw))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	var rows KeyValues
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := t.(string)
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		var text string
+		if json.Unmarshal(value, &text) != nil {
+			text = string(value)
+		}
+		rows = append(rows, KeyValue{Key: key, Value: text})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// keyValuesFromMap turns a map into rows sorted by key.
+func keyValuesFromMap(m map[string]string) KeyValues {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := make(KeyValues, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, KeyValue{Key: key, Value: m[key]})
+	}
+	return rows
+}
+
+// enabled returns the rows that are sent, skipping disabled and blank ones.
+func (kvs KeyValues) enabled() KeyValues {
+	var rows KeyValues
+	for _, kv := range kvs {
+		if !kv.Disabled && kv.Key != "" {
+			rows = append(rows, kv)
+		}
+	}
+	return rows
+}
+
+// resolved returns the enabled rows with resolve applied to their keys and
+// values.
+func (kvs KeyValues) resolved(resolve func(string) string) KeyValues {
+	var rows KeyValues
+	for _, kv := range kvs.enabled() {
+		rows = append(rows, KeyValue{Key: resolve(kv.Key), Value: resolve(kv.Value), Type: kv.Type, KeyOnly: kv.KeyOnly})
+	}
+	return rows
+}
+
+// toMap returns the enabled rows as a map, later rows winning over earlier
+// ones with the same key.
+func (kvs KeyValues) toMap() map[string]string {
+	m := map[string]string{}
+	for _, kv := range kvs.enabled() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+// applyMap updates the rows to match m, as edited from a map by a script.
+// Unchanged rows, repeated keys and disabled rows are kept; keys missing from
+// m are removed and new keys are added at the end.
+func (kvs KeyValues) applyMap(m map[string]string) KeyValues {
+	current := kvs.toMap()
+	var rows KeyValues
+	done := map[string]bool{}
+	for _, kv := range kvs {
+		if kv.Disabled || kv.Key == "" {
+			rows = append(rows, kv)
+			continue
+		}
+		value, ok := m[kv.Key]
+		if !ok {
+			continue
+		}
+		if current[kv.Key] == value {
+			rows = append(rows, kv)
+		} else if !done[kv.Key] {
+			kv.Value = value
+			rows = append(rows, kv)
+		}
+		done[kv.Key] = true
+	}
+	for _, kv := range keyValuesFromMap(m) {
+		if !done[kv.Key] {
+			rows = append(rows, kv)
+		}
+	}
+	return rows
+}
+
+// texts returns the keys and values of the enabled rows, for looking up
+// placeholders.
+func (kvs KeyValues) texts() []string {
+	var texts []string
+	for _, kv := range kvs.enabled() {
+		texts = append(texts, kv.Key, kv.Value)
+	}
+	return texts
+}
+
+// header returns the value of the first enabled row named name, matching it
+// case-insensitively as header names are.
+func (kvs KeyValues) header(name string) (string, bool) {
+	for _, kv := range kvs.enabled() {
+		if strings.EqualFold(kv.Key, name) {
+			return kv.Value, true
+		}
+	}
+	return "", false
+}
+
+// setHeader sets the first enabled row named name, or adds one.
+func (kvs KeyValues) setHeader(name, value string) KeyValues {
+	for i, kv := range kvs {
+		if !kv.Disabled && strings.EqualFold(kv.Key, name) {
+			kvs[i].Value = value
+			return kvs
+		}
+	}
+	return append(kvs, KeyValue{Key: name, Value: value})
+}
+
+// parseQuery reads a query string into rows, keeping their order and any
+// repeated keys. Parts that aren't valid escapes are kept as written.
+func parseQuery(rawQuery string) KeyValues {
+	var rows KeyValues
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		rows = append(rows, KeyValue{Key: key, Value: value, KeyOnly: !hasValue})
+	}
+	return rows
+}
+
+// queryPair writes a row of a query string with escape, leaving out the "="
+// of a key typed without one.
+func queryPair(kv KeyValue, escape func(string) string) string {
+	if kv.KeyOnly && kv.Value == "" {
+		return escape(kv.Key)
+	}
+	return escape(kv.Key) + "=" + escape(kv.Value)
+}
+
+// encodeQuery writes the enabled rows as a query string, in order.
+func encodeQuery(kvs KeyValues) string {
+	var parts []string
+	for _, kv := range kvs.enabled() {
+		parts = append(parts, queryPair(kv, url.QueryEscape))
+	}
+	return strings.Join(parts, "&")
+}
+
+// splitURL cuts a URL into the part before its query string, the query string
+// and the fragment. Placeholders such as {{host}} in the URL stop it from
+// being parsed with net/url, so it is cut by hand.
+func splitURL(rawURL string) (base, query, fragment string) {
+	base, fragment, hasFragment := strings.Cut(rawURL, "#")
+	if hasFragment {
+		fragment = "#" + fragment
+	}
+	base, query, _ = strings.Cut(base, "?")
+	return base, query, fragment
+}
+
+// displayQuery writes the enabled rows as a query string for the URL field.
+// It is escaped like encodeQuery, but {{placeholders}} are kept as typed.
+func displayQuery(kvs KeyValues) string {
+	escape := func(s string) string {
+		var b strings.Builder
+		last := 0
+		for _, loc := range placeholderRegexp.FindAllStringIndex(s, -1) {
+			b.WriteString(url.QueryEscape(s[last:loc[0]]))
+			b.WriteString(s[loc[0]:loc[1]])
+			last = loc[1]
+		}
+		b.WriteString(url.QueryEscape(s[last:]))
+		return b.String()
+	}
+
+	var parts []string
+	for _, kv := range kvs.enabled() {
+		parts = append(parts, queryPair(kv, escape))
+	}
+	return strings.Join(parts, "&")
+}
+
+// withQuery replaces the enabled rows with those parsed from a query string,
+// keeping the disabled rows and the descriptions of rows in the same place.
+func (kvs KeyValues) withQuery(query KeyValues) KeyValues {
+	var rows KeyValues
+	for _, kv := range kvs {
+		switch {
+		case kv.Disabled || kv.Key == "":
+			rows = append(rows, kv)
+		case len(query) > 0:
+			next := query[0]
+			next.Description = kv.Description
+			rows = append(rows, next)
+			query = query[1:]
+		}
+	}
+	return append(rows, query...)
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestKeyValuesUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want KeyValues
+	}{
+		{"baseline text", `"{\"Accept\": \"*/*\", \"X-Trace\": \"one\"}"`, KeyValues{{Key: "Accept", Value: "*/*"}, {Key: "X-Trace", Value: "one"}}},
+		{"order of the text", `"{\"b\": \"2\", \"a\": \"1\", \"c\": \"3\"}"`, KeyValues{{Key: "b", Value: "2"}, {Key: "a", Value: "1"}, {Key: "c", Value: "3"}}},
+		{"repeated keys", `"{\"id\": \"1\", \"id\": \"2\"}"`, KeyValues{{Key: "id", Value: "1"}, {Key: "id", Value: "2"}}},
+		{"values that aren't strings", `"{\"page\": 2, \"on\": true, \"tags\": [\"a\"], \"none\": null}"`, KeyValues{{Key: "page", Value: "2"}, {Key: "on", Value: "true"}, {Key: "tags", Value: `["a"]`}, {Key: "none", Value: ""}}},
+		{"empty text", `""`, nil},
+		{"blank text", `"  \n"`, nil},
+		{"empty object", `"{}"`, nil},
+		{"rows", `[{"key": "Accept", "value": "*/*"}, {"key": "id", "value": "1", "disabled": true, "description": "old"}, {"key": "id", "value": "2"}, {"key": "file", "value": "a.txt", "type": "file"}]`,
+			KeyValues{{Key: "Accept", Value: "*/*"}, {Key: "id", Value: "1", Disabled: true, Description: "old"}, {Key: "id", Value: "2"}, {Key: "file", Value: "a.txt", Type: formFile}}},
+		{"no rows", `[]`, KeyValues{}},
+		{"null", `null`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got KeyValues
+			if err := json.Unmarshal([]byte(tt.raw), &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("row %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestKeyValuesUnmarshalKeepsBrokenText(t *testing.T) {
+	for _, raw := range []string{`{"Accept": `, `["Accept"]`, `not json`, `{"Accept": "*/*",}`} {
+		text, _ := json.Marshal(raw)
+		var got KeyValues
+		if err := json.Unmarshal(text, &got); err != nil {
+			t.Errorf("%s: %v", raw, err)
+			continue
+		}
+		if len(got) != 1 || got[0].Key != "" || got[0].Value != raw || !got[0].Disabled || !strings.HasPrefix(got[0].Description, "couldn't be read: ") {
+			t.Errorf("%s = %+v, want a disabled row holding the text", raw, got)
+		}
+		if len(got.enabled()) != 0 {
+			t.Errorf("%s: the broken row would be sent", raw)
+		}
+	}
+
+	var got KeyValues
+	if err := json.Unmarshal([]byte(`{"Accept": "*/*"}`), &got); err == nil {
+		t.Errorf("an object that isn't text was read as %+v", got)
+	}
+}
+
+func TestRequestMigratesBaselineTabs(t *testing.T) {
+	baseline := `{
+		"id": "1",
+		"name": "old",
+		"url": "https://example.com/items",
+		"method": "GET",
+		"headers": "{\n\t\"Accept\": \"*/*\",\n\t\"X-Id\": \"1\",\n\t\"X-Id\": \"2\"\n}",
+		"body": "",
+		"queryParams": "{\"page\": \"2\"}",
+		"response": ""
+	}`
+	var r Request
+	if err := json.Unmarshal([]byte(baseline), &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Headers) != 3 || r.Headers[0] != (KeyValue{Key: "Accept", Value: "*/*"}) || r.Headers[2] != (KeyValue{Key: "X-Id", Value: "2"}) {
+		t.Errorf("headers = %+v", r.Headers)
+	}
+	if len(r.QueryParams) != 1 || r.QueryParams[0] != (KeyValue{Key: "page", Value: "2"}) {
+		t.Errorf("params = %+v", r.QueryParams)
+	}
+
+	// Saving writes the rows, which read back the same
+	saved, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again Request
+	if err := json.Unmarshal(saved, &again); err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Headers) != 3 || again.Headers[1] != r.Headers[1] || again.Headers[2] != r.Headers[2] {
+		t.Errorf("headers after saving = %+v", again.Headers)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  KeyValues
+	}{
+		{"a=1&b=2&a=3", KeyValues{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}, {Key: "a", Value: "3"}}},
+		{"q=a+b&r=a%20b&s=a%2Bb", KeyValues{{Key: "q", Value: "a b"}, {Key: "r", Value: "a b"}, {Key: "s", Value: "a+b"}}},
+		{"bad=%zz&%zz=1&half=%2", KeyValues{{Key: "bad", Value: "%zz"}, {Key: "%zz", Value: "1"}, {Key: "half", Value: "%2"}}},
+		{"flag&empty=&x=1", KeyValues{{Key: "flag", KeyOnly: true}, {Key: "empty"}, {Key: "x", Value: "1"}}},
+		{"eq=a=b&&", KeyValues{{Key: "eq", Value: "a=b"}}},
+		{"token={{token}}&q={{first name}}", KeyValues{{Key: "token", Value: "{{token}}"}, {Key: "q", Value: "{{first name}}"}}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := parseQuery(tt.query)
+		if len(got) != len(tt.want) {
+			t.Errorf("%q = %+v, want %+v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: row %d = %+v, want %+v", tt.query, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestQueryRoundTrip(t *testing.T) {
+	tests := []struct {
+		typed   string
+		display string
+		sent    string
+	}{
+		{"a=1&b=2&a=3", "a=1&b=2&a=3", "a=1&b=2&a=3"},
+		{"q=a+b", "q=a+b", "q=a+b"},
+		{"q=a%20b", "q=a+b", "q=a+b"},
+		{"q=a%2Bb%26c", "q=a%2Bb%26c", "q=a%2Bb%26c"},
+		{"bad=%zz", "bad=%25zz", "bad=%25zz"},
+		{"flag", "flag", "flag"},
+		{"flag=", "flag=", "flag="},
+		{"flag&x=1&other", "flag&x=1&other", "flag&x=1&other"},
+		{"token={{token}}", "token={{token}}", "token=%7B%7Btoken%7D%7D"},
+		{"q={{first}} {{last}}&{{key}}=1", "q={{first}}+{{last}}&{{key}}=1", "q=%7B%7Bfirst%7D%7D+%7B%7Blast%7D%7D&%7B%7Bkey%7D%7D=1"},
+		{"{{flag}}", "{{flag}}", "%7B%7Bflag%7D%7D"},
+	}
+	for _, tt := range tests {
+		rows := parseQuery(tt.typed)
+		if got := displayQuery(rows); got != tt.display {
+			t.Errorf("%q is shown as %q, want %q", tt.typed, got, tt.display)
+		}
+		if got := displayQuery(parseQuery(tt.display)); got != tt.display {
+			t.Errorf("%q is shown as %q after a second pass", tt.display, got)
+		}
+		if got := encodeQuery(rows); got != tt.sent {
+			t.Errorf("%q is sent as %q, want %q", tt.typed, got, tt.sent)
+		}
+	}
+
+	// A value typed for a key that had no "=" gets one
+	rows := parseQuery("flag")
+	rows[0].Value = "on"
+	if got := displayQuery(rows); got != "flag=on" {
+		t.Errorf("flag with a value = %q", got)
+	}
+}
+
+func TestWithQuery(t *testing.T) {
+	rows := KeyValues{
+		{Key: "a", Value: "1", Description: "first"},
+		{Key: "off", Value: "x", Disabled: true, Description: "kept"},
+		{Key: "b", Value: "2", Description: "second"},
+		{Description: "a note"},
+	}
+
+	got := rows.withQuery(parseQuery("a=9&c=3&d=4"))
+	want := KeyValues{
+		{Key: "a", Value: "9", Description: "first"},
+		{Key: "off", Value: "x", Disabled: true, Description: "kept"},
+		{Key: "c", Value: "3", Description: "second"},
+		{Description: "a note"},
+		{Key: "d", Value: "4"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("rows = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Clearing the query string keeps only the disabled and blank rows
+	got = rows.withQuery(nil)
+	if len(got) != 2 || got[0].Key != "off" || got[1].Description != "a note" {
+		t.Errorf("rows without a query = %+v", got)
+	}
+}
+
+func TestSyncURLAndParams(t *testing.T) {
+	useTempData(t)
+	m := NewModel()
+	m.paramsTable.SetRows(KeyValues{
+		{Key: "page", Value: "1", Description: "the page"},
+		{Key: "debug", Value: "1", Disabled: true},
+	})
+
+	typed := "https://{{host}}/search?page=2&q=a%20b&flag&bad=%zz&token={{token}}#results"
+	m.urlField.SetValue(typed)
+	m.syncParamsFromURL()
+	want := KeyValues{
+		{Key: "page", Value: "2", Description: "the page"},
+		{Key: "debug", Value: "1", Disabled: true},
+		{Key: "q", Value: "a b"},
+		{Key: "flag", KeyOnly: true},
+		{Key: "bad", Value: "%zz"},
+		{Key: "token", Value: "{{token}}"},
+	}
+	got := m.paramsTable.Rows()
+	if len(got) != len(want) {
+		t.Fatalf("params = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("param %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if m.urlField.Value() != typed {
+		t.Errorf("typing in the URL rewrote it to %q", m.urlField.Value())
+	}
+
+	// Editing the params rewrites the query string, escaped as it is sent
+	rows := m.paramsTable.Rows()
+	rows[0].Value = "3"
+	m.paramsTable.SetRows(rows)
+	m.syncURLFromParams()
+	if got, want := m.urlField.Value(), "https://{{host}}/search?page=3&q=a+b&flag&bad=%25zz&token={{token}}#results"; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+
+	// and reading it back changes nothing
+	m.syncParamsFromURL()
+	if again := m.paramsTable.Rows(); !slices.Equal(again, rows) {
+		t.Errorf("params after a round trip = %+v, want %+v", again, rows)
+	}
+
+	// Without enabled params the query string goes, the fragment stays
+	m.paramsTable.SetRows(KeyValues{{Key: "debug", Value: "1", Disabled: true}})
+	m.syncURLFromParams()
+	if got := m.urlField.Value(); got != "https://{{host}}/search#results" {
+		t.Errorf("URL without params = %q", got)
+	}
+}
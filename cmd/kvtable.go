@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Columns of a kvTable.
+const (
+	keyColumn = iota
+	valueColumn
+	descriptionColumn
+)
+
+const (
+	kvTableHelp    = "enter next cell · ctrl+t enable/disable · ctrl+x delete row"
+	typedTableHelp = kvTableHelp + " · ctrl+f text/file"
+	fixedTableHelp = "enter next field"
+)
+
+// kvTable edits KeyValues as a table with a key, value and description for
+// each row. The row after the last one is blank, typing in it adds a row.
+type kvTable struct {
+	rows    KeyValues
+	row     int
+	col     int
+	width   int
+	height  int
+	focused bool
+	// fixed tables only have their values edited, their rows are set by
+	// the program and the description explains each one
+	fixed bool
+	// typed tables show whether each row is text or a file to upload,
+	// switched with ctrl+f
+	typed bool
+	// input edits the cell under the cursor
+	input textinput.Model
+}
+
+func newKVTable() kvTable {
+	input := textinput.New()
+	input.Prompt = ""
+	input.Cursor.Style = cursorStyle
+	input.Cursor.Blink = false
+	return kvTable{input: input}
+}
+
+// SetRows replaces the rows and moves the cursor to the first one.
+func (t *kvTable) SetRows(rows KeyValues) {
+	t.rows = append(KeyValues(nil), rows...)
+	t.row, t.col = 0, keyColumn
+	if t.fixed {
+		t.col = valueColumn
+	}
+	t.loadCell()
+}
+
+// Rows returns the rows, leaving out ones that are entirely blank.
+func (t kvTable) Rows() KeyValues {
+	var rows KeyValues
+	for _, kv := range t.rows {
+		if kv.Key != "" || kv.Value != "" || kv.Description != "" {
+			rows = append(rows, kv)
+		}
+	}
+	return rows
+}
+
+func (t *kvTable) SetSize(width, height int) {
+	t.width, t.height = width, height
+}
+
+func (t *kvTable) Focus() {
+	t.focused = true
+	t.input.Focus()
+}
+
+func (t *kvTable) Blur() {
+	t.focused = false
+	t.input.Blur()
+}
+
+func (t kvTable) Update(msg tea.Msg) (kvTable, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		switch keyMsg.String() {
+		case "up":
+			t.moveTo(t.row-1, t.col)
+			return t, nil
+		case "down":
+			t.moveTo(t.row+1, t.col)
+			return t, nil
+		case "enter":
+			if t.fixed {
+				t.moveTo(t.row+1, t.col)
+			} else if t.col < descriptionColumn {
+				t.moveTo(t.row, t.col+1)
+			} else {
+				t.moveTo(t.row+1, keyColumn)
+			}
+			return t, nil
+		case "left":
+			if t.input.Position() == 0 && t.col > keyColumn && !t.fixed {
+				t.moveTo(t.row, t.col-1)
+				t.input.CursorEnd()
+				return t, nil
+			}
+		case "right":
+			if t.input.Position() == len([]rune(t.input.Value())) && t.col < descriptionColumn && !t.fixed {
+				t.moveTo(t.row, t.col+1)
+				t.input.CursorStart()
+				return t, nil
+			}
+		case "ctrl+t":
+			if t.row < len(t.rows) && !t.fixed {
+				t.rows[t.row].Disabled = !t.rows[t.row].Disabled
+			}
+			return t, nil
+		case "ctrl+f":
+			if t.row < len(t.rows) && t.typed {
+				kv := &t.rows[t.row]
+				if kv.Type == formFile {
+					kv.Type = ""
+				} else {
+					kv.Type = formFile
+				}
+			}
+			return t, nil
+		case "ctrl+x":
+			if t.row < len(t.rows) && !t.fixed {
+				t.rows = append(t.rows[:t.row:t.row], t.rows[t.row+1:]...)
+				t.loadCell()
+			}
+			return t, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	t.input, cmd = t.input.Update(msg)
+	t.storeCell()
+	return t, cmd
+}
+
+// moveTo moves the cursor to a cell, dropping the row it leaves when that
+// row was left blank.
+func (t *kvTable) moveTo(row, col int) {
+	if t.fixed {
+		t.row = max(0, min(row, len(t.rows)-1))
+		t.loadCell()
+		return
+	}
+	if t.row < len(t.rows) && row != t.row && t.rows[t.row] == (KeyValue{}) {
+		t.rows = append(t.rows[:t.row:t.row], t.rows[t.row+1:]...)
+		if row > t.row {
+			row--
+		}
+	}
+	t.row = max(0, min(row, len(t.rows)))
+	t.col = col
+	t.loadCell()
+}
+
+// loadCell puts the cell under the cursor into the input.
+func (t *kvTable) loadCell() {
+	var value string
+	if t.row < len(t.rows) {
+		value = *t.cell(&t.rows[t.row])
+	}
+	t.input.SetValue(value)
+	t.input.CursorEnd()
+}
+
+// storeCell writes the input back to the cell under the cursor, adding a row
+// when the blank row is typed in.
+func (t *kvTable) storeCell() {
+	if t.row == len(t.rows) {
+		if t.input.Value() == "" || t.fixed {
+			return
+		}
+		t.rows = append(t.rows, KeyValue{})
+	}
+	*t.cell(&t.rows[t.row]) = t.input.Value()
+}
+
+func (t kvTable) cell(kv *KeyValue) *string {
+	switch t.col {
+	case valueColumn:
+		return &kv.Value
+	case descriptionColumn:
+		return &kv.Description
+	}
+	return &kv.Key
+}
+
+func (t kvTable) View() string {
+	// A checkbox, the type of typed tables, then the key, value and
+	// description
+	typeWidth := 0
+	if t.typed {
+		typeWidth = 5
+	}
+	widths := []int{0, 0, 0}
+	rest := max(t.width-4-typeWidth, 9)
+	widths[keyColumn] = rest * 3 / 10
+	widths[valueColumn] = rest * 4 / 10
+	widths[descriptionColumn] = rest - widths[keyColumn] - widths[valueColumn]
+
+	cell := func(text string, width int) string {
+		text = ansi.Truncate(text, width-1, "…")
+		return text + strings.Repeat(" ", max(width-lipgloss.Width(text), 0))
+	}
+
+	var b strings.Builder
+	headings := []string{"Key", "Value", "Description"}
+	help := kvTableHelp
+	if t.typed {
+		help = typedTableHelp
+	}
+	last := len(t.rows)
+	if t.fixed {
+		headings = []string{"Field", "Value", ""}
+		help = fixedTableHelp
+		last = len(t.rows) - 1
+	}
+	b.WriteString(keyStyle.Render("    " + strings.Repeat(" ", typeWidth) + cell(headings[0], widths[keyColumn]) + cell(headings[1], widths[valueColumn]) + cell(headings[2], widths[descriptionColumn])))
+
+	// Keep the cursor row in view, leaving room for the heading and help
+	visible := max(t.height-2, 1)
+	offset := max(t.row-visible+1, 0)
+
+	for i := offset; i <= last && i < offset+visible; i++ {
+		var kv KeyValue
+		if i < len(t.rows) {
+			kv = t.rows[i]
+		}
+		texts := []string{kv.Key, kv.Value, kv.Description}
+
+		check := "[x] "
+		if t.fixed {
+			check = "    "
+		}
+		if kv.Disabled {
+			check = "[ ] "
+		}
+		if i == len(t.rows) {
+			check = "    "
+			if i != t.row || !t.focused {
+				texts[keyColumn] = "add a row"
+			}
+		}
+
+		line := check
+		if t.typed {
+			kind := "text "
+			if kv.Type == formFile {
+				kind = "file "
+			}
+			if i == len(t.rows) {
+				kind = "     "
+			}
+			line += kind
+		}
+		for col, text := range texts {
+			if i == t.row && col == t.col && t.focused {
+				t.input.Width = widths[col] - 2
+				line += cell(t.input.View(), widths[col])
+				continue
+			}
+			if t.fixed && col == descriptionColumn {
+				text = placeholderStyle.Render(text)
+			}
+			line += cell(text, widths[col])
+		}
+
+		switch {
+		case i == len(t.rows) && (i != t.row || !t.focused):
+			line = placeholderStyle.Render(line)
+		case kv.Disabled:
+			line = disabledStyle.Render(line)
+		}
+		b.WriteString("\n" + line)
+	}
+
+	body := lipgloss.NewStyle().Height(max(t.height-1, 1)).Render(b.String())
+	return body + "\n" + placeholderStyle.Render(ansi.Truncate(help, t.width, "…"))
+}
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/atotto/clipboard"
@@ -11,9 +13,27 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/muesli/reflow/wordwrap"
 )
 
+// Indexes of the request tabs in Model.tabs and Model.tabContent.
+const (
+	bodyTab = iota
+	paramsTab
+	headersTab
+	authTab
+	settingsTab
+	testsTab
+	extractTab
+	scriptsTab
+	// postScriptContent is the extra textarea holding the post-response
+	// script, shown in the scripts tab in place of the pre-request one.
+	postScriptContent
+	// binaryContent holds the path of the file sent as a binary body.
+	binaryContent
+)
+
 type Model struct {
 	lg               *lipgloss.Renderer
 	styles           *Styles
@@ -28,13 +48,29 @@ type Model struct {
 	activeTab        int
 	response         string
 	status           string
-	id               string
-	focused          int
-	fields           []string
-	spinner          spinner.Model
-	message          string
-	loading          bool
-	apiResponse      string
+	result           result
+	timings          *Timings
+
+	// Tabs of the response panel
+	responseTabs      []string
+	activeResponseTab int
+	id                string
+	focused           int
+	fields            []string
+	spinner           spinner.Model
+	message           string
+	loading           bool
+	apiResponse       string
+
+	// folder groups the request, as imported from a Postman collection
+	folder string
+	// environment is the name of the active environment, "" for none
+	environment string
+
+	// cancel aborts the request that is currently in flight, if any.
+	cancel context.CancelFunc
+	// requestID identifies the latest request so stale responses are dropped.
+	requestID int
 
 	// Histories for auto-completion (derived from saved requests)
 	nameHistory []string
@@ -46,6 +82,27 @@ type Model struct {
 	// HTTP method selection options/index
 	methodOptions []string
 	methodIndex   int
+
+	// showPostScript shows the post-response script in the scripts tab
+	showPostScript bool
+
+	// The Params and Headers tabs are edited as tables rather than in
+	// their textareas
+	paramsTable  kvTable
+	headersTable kvTable
+
+	// bodyType picks how the Body tab is edited and sent, and formTable
+	// holds the fields of form and multipart bodies
+	bodyType  string
+	formTable kvTable
+
+	// auth holds what was typed for each auth type, and authTable edits the
+	// fields of the selected one
+	auth      Auth
+	authTable kvTable
+	// oauthToken is the cached OAuth 2.0 token shown in the Auth tab, read
+	// when the auth changes and after a send rather than on every render
+	oauthToken *oauthToken
 }
 
 func NewModel() Model {
@@ -54,7 +111,8 @@ func NewModel() Model {
 	m.lg = lipgloss.DefaultRenderer()
 	m.styles = NewStyles(m.lg)
 	m.id = ""
-	m.tabs = []string{"Body", "Params", "Headers"}
+	m.tabs = []string{"Body", "Params", "Headers", "Auth", "Settings", "Tests", "Extract", "Pre-script"}
+	m.responseTabs = []string{"Body", "Headers", "Cookies", "Info", "Tests", "Console"}
 
 	m.nameField = textinput.New()
 	m.nameField.Cursor.Blink = false
@@ -71,7 +129,7 @@ func NewModel() Model {
 	m.methodField = textinput.New()
 	m.methodField.Placeholder = "METHOD"
 	m.methodField.Focus()
-	m.methodField.CharLimit = 7
+	m.methodField.CharLimit = 12 // room for custom verbs such as PROPFIND
 	m.methodField.Cursor.Blink = false
 
 	// Initialize HTTP method list and default selection
@@ -79,22 +137,29 @@ func NewModel() Model {
 	m.methodIndex = 0
 	m.methodField.SetValue(m.methodOptions[m.methodIndex])
 
-	// Initialize tab contents
-	for range m.tabs {
+	// Initialize tab contents, plus the post-response script
+	for range binaryContent + 1 {
 		ta := newTextarea()
 		ta.Cursor.Blink = false
 
 		m.tabContent = append(m.tabContent, ta)
 	}
 
-	m.tabContent[1].Placeholder = `
-	write Query Params in key-value format
-
-{
-	"key":"value"
-}`
-
-	m.tabContent[2].SetValue(createHeaders())
+	m.paramsTable = newKVTable()
+	m.headersTable = newKVTable()
+	m.headersTable.SetRows(createHeaders())
+
+	m.tabContent[settingsTab].Placeholder = settingsPlaceholder
+	m.tabContent[testsTab].Placeholder = testsPlaceholder
+	m.tabContent[extractTab].Placeholder = extractPlaceholder
+	m.tabContent[scriptsTab].Placeholder = preScriptPlaceholder
+	m.tabContent[postScriptContent].Placeholder = postScriptPlaceholder
+	m.tabContent[binaryContent].Placeholder = "path/to/file"
+	m.bodyType = bodyJSON
+	m.formTable = newKVTable()
+	m.auth = Auth{Type: authNone}
+	m.authTable = newKVTable()
+	m.authTable.fixed = true
 
 	vp := viewport.New(m.width, m.height)
 	m.responseViewport = vp
@@ -108,8 +173,11 @@ func NewModel() Model {
 	m.message = m.appBoundaryView("Ctrl+c to quit, Ctrl+h for help")
 	m.loading = false
 
+	saved := getSavedData()
+	m.environment = saved.ActiveEnvironment
+
 	// Build histories from saved requests (for auto-complete)
-	if saved := getSavedData(); len(saved.Requests) > 0 {
+	if len(saved.Requests) > 0 {
 		dedup := func(list []string) []string {
 			m := map[string]struct{}{}
 			out := make([]string, 0, len(list))
@@ -164,26 +232,91 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "shift+left":
 			m.activeTab = max(m.activeTab-1, 0)
 			return m, nil
+		case "ctrl+right":
+			m.activeResponseTab = min(m.activeResponseTab+1, len(m.responseTabs)-1)
+			m.sizeInputs()
+			m.refreshResponse()
+			return m, nil
+		case "ctrl+left":
+			m.activeResponseTab = max(m.activeResponseTab-1, 0)
+			m.sizeInputs()
+			m.refreshResponse()
+			return m, nil
+		case "ctrl+t":
+			if m.activeTab == scriptsTab {
+				m.showPostScript = !m.showPostScript
+				return m, nil
+			}
+			if m.activeTab == bodyTab && (m.focused != 3 || m.table() == nil) {
+				// In a form table ctrl+t enables or disables the row instead
+				next := (slices.Index(bodyTypes, m.bodyType) + 1) % len(bodyTypes)
+				m.bodyType = bodyTypes[next]
+				m.message = m.appBoundaryView("Body type: " + bodyTypeLabels[m.bodyType])
+				return m, nil
+			}
+			if m.activeTab == authTab {
+				m.auth.setRows(m.authTable.Rows())
+				next := (slices.Index(authTypes, m.auth.Type) + 1) % len(authTypes)
+				m.auth.Type = authTypes[next]
+				if m.auth.Type == authAWSv4 {
+					m.auth = awsPlaceholders(m.auth)
+				}
+				m.authTable.SetRows(m.auth.rows())
+				m.loadOAuthToken()
+				m.message = m.appBoundaryView("Auth: " + authTypeLabels[m.auth.Type])
+				return m, nil
+			}
+		case "ctrl+x":
+			if m.activeTab == authTab && m.auth.Type == authOAuth2 {
+				// Forget the cached token, the next send fetches a new one
+				message := "OAuth 2.0 token forgotten"
+				if err := storeToken(oauthSettings(m.request().Auth, currentVariables()), nil); err != nil {
+					message = "Couldn't forget the token: " + err.Error()
+				}
+				m.loadOAuthToken()
+				m.message = m.appBoundaryView(message)
+				return m, nil
+			}
 		case "ctrl+e":
 			environment := environment(m)
 			return environment, nil
+		case "ctrl+o":
+			picker := environmentPicker(m)
+			return picker, nil
+		case "esc":
+			if m.cancel != nil {
+				m.cancel()
+				m.cancel = nil
+				m.message = m.appBoundaryMessage("Cancelling Request....")
+				return m, nil
+			}
 		case "enter":
 
 			if m.focused != 3 {
 
+				if m.cancel != nil {
+					// A request is already in flight
+					return m, nil
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				m.cancel = cancel
+				m.requestID++
+				id := m.requestID
+
 				m.loading = true
-				m.message = m.appBoundaryMessage("Sending Request....")
+				m.message = m.appBoundaryMessage("Sending Request.... (<ESC> to cancel)")
 
 				m.spinner, cmd = m.spinner.Update(msg)
 				cmds = append(cmds, cmd)
 
 				// Perform the async operation in a goroutine
 				return m, func() tea.Msg {
-					response, status := send(m) // Simulate the send function
-					formattedResponse := formatJSON(response)
+					res := send(ctx, m)
 					return responseMsg{
-						response: formattedResponse,
-						status:   status,
+						id:       id,
+						response: formatJSON(res.body),
+						result:   res,
 					}
 				}
 			}
@@ -191,6 +324,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "ctrl+d":
 			dashboard := dashboard(m.width, m.height, m.styles, &m)
 			return dashboard, nil
+		case "ctrl+r":
+			history := history(m.width, m.height, m.styles, &m)
+			return history, nil
 		case "ctrl+s":
 
 			m.loading = true
@@ -249,6 +385,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			clipboard.WriteAll(txt)
 			m.message = m.appBoundaryMessage("Response Copied ...")
 			return m, nil
+
+		case "ctrl+g", "alt+g":
+			// ctrl+g resolves variables, alt+g keeps the {{placeholders}}
+			variables, err := getSavedData().variables("")
+			if err != nil {
+				m.message = m.appBoundaryMessage("Incorrect Env Variables: " + err.Error())
+				return m, nil
+			}
+			command, err := exportCurl(m.request(), variables, keypress == "alt+g")
+			if err != nil {
+				m.message = m.appBoundaryMessage("Can't export request: " + strings.TrimSpace(err.Error()))
+				return m, nil
+			}
+			clipboard.WriteAll(command)
+			m.message = m.appBoundaryMessage("curl Command Copied ...")
+			return m, nil
 		}
 
 	}
@@ -258,10 +410,44 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Handle custom messages for async tasks
 	switch msg := msg.(type) {
 	case responseMsg:
+		if msg.id != m.requestID {
+			// Response to a request that was cancelled and replaced
+			break
+		}
+		if m.cancel != nil {
+			m.cancel()
+			m.cancel = nil
+		}
 		m.response = msg.response
-		m.status = msg.status
+		m.result = msg.result
+		m.status = msg.result.status
+		m.timings = msg.result.timings
 		m.loading = false
+		m.loadOAuthToken()
 		m.message = m.appBoundaryMessage("Request Sent!")
+		var notes []string
+		if len(m.result.unresolved) > 0 {
+			notes = append(notes, "unresolved "+placeholderList(m.result.unresolved))
+		}
+		if m.result.insecure && m.result.statusCode != 0 {
+			notes = append(notes, "certificate not verified")
+		}
+		if len(m.result.tests) > 0 || len(m.result.extracted) > 0 {
+			if len(m.result.tests) > 0 {
+				notes = append(notes, testsSummary(m.result.tests))
+			}
+			if len(m.result.extracted) > 0 {
+				notes = append(notes, extractSummary(m.result))
+			}
+			notes[len(notes)-1] += " (see the Tests tab)"
+		}
+		if len(notes) > 0 {
+			sent := "Request Sent! "
+			if m.result.statusCode == 0 && len(m.result.unresolved) > 0 {
+				sent = "Request Blocked! "
+			}
+			m.message = m.appBoundaryMessage(sent + strings.Join(notes, ", "))
+		}
 
 		// Update in-session histories from current inputs
 		if v := strings.TrimSpace(m.nameField.Value()); v != "" {
@@ -289,10 +475,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
-		wrappedContent := wordwrap.String(m.response, m.responseViewport.Width)
-		m.apiResponse = wrappedContent
-		m.responseViewport.SetContent(wrappedContent)
-		m.responseViewport.GotoTop()
+		m.apiResponse = wordwrap.String(m.response, m.responseViewport.Width)
+		m.refreshResponse()
 	case saveMsg:
 		m.loading = false
 		m.message = m.appBoundaryMessage(msg.message)
@@ -334,13 +518,31 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.methodField, cmd = m.methodField.Update(msg)
 		cmds = append(cmds, cmd)
 	case 2:
+		typed := m.urlField.Value()
 		m.urlField, cmd = m.urlField.Update(msg)
+		if m.urlField.Value() != typed {
+			m.syncParamsFromURL()
+		}
 		// Update inline suggestion hint for URL
 		m.recomputeInlineSuggestion("url")
 		cmds = append(cmds, cmd)
 	case 3:
 		// Update the active tab in the tabContent array
-		m.tabContent[m.activeTab], cmd = m.tabContent[m.activeTab].Update(msg)
+		if (m.activeTab == bodyTab && m.bodyType == bodyNone) || (m.activeTab == authTab && m.auth.Type == authNone) {
+			// Nothing to edit
+		} else if table := m.table(); table != nil {
+			rows := table.Rows()
+			table.Focus()
+			*table, cmd = table.Update(msg)
+			if m.activeTab == paramsTab && !slices.Equal(rows, table.Rows()) {
+				m.syncURLFromParams()
+			}
+			if m.activeTab == authTab && !slices.Equal(rows, table.Rows()) {
+				m.loadOAuthToken()
+			}
+		} else {
+			m.tabContent[m.contentIndex()], cmd = m.tabContent[m.contentIndex()].Update(msg)
+		}
 		cmds = append(cmds, cmd)
 	}
 
@@ -370,38 +572,89 @@ func (m Model) View() string {
 	var footer string
 
 	doc := strings.Builder{}
-	var renderedTabs []string
-
-	for i, t := range m.tabs {
-		var style lipgloss.Style
-		isActive := i == m.activeTab
-		if isActive {
-			style = activeTabStyle
-		} else {
-			style = inactiveTabStyle
-		}
-
-		renderedTabs = append(renderedTabs, style.Render(t))
-	}
 
 	tabContentWidth := int(float64(m.width) * 0.5)
 
-	tabRow := lipgloss.JoinHorizontal(lipgloss.Top, renderedTabs...)
+	labels := append([]string(nil), m.tabs...)
+	if m.showPostScript {
+		labels[scriptsTab] = "Post-script"
+	}
+	requestTabRow := tabRow(labels, m.activeTab, tabContentWidth-2)
 
 	tabStyle := borderStyle
+	table := m.table()
 	if m.focused == 3 {
-		m.tabContent[m.activeTab].Focus()
+		if table != nil {
+			table.Focus()
+		} else {
+			m.tabContent[m.contentIndex()].Focus()
+		}
 		tabStyle = focusedBorder
 	} else {
-		m.tabContent[m.activeTab].Blur()
+		if table != nil {
+			table.Blur()
+		} else {
+			m.tabContent[m.contentIndex()].Blur()
+		}
 	}
 
+	if m.activeTab == authTab && m.auth.Type == authOAuth2 {
+		// Make room for the token under the type
+		table.SetSize(table.width, table.height-1)
+	}
+	editor := m.tabContent[m.contentIndex()].View()
+	if table != nil {
+		editor = table.View()
+	}
+	if m.activeTab == bodyTab {
+		if m.bodyType == bodyNone {
+			editor = ""
+		}
+		change := "  ctrl+t to change"
+		if table != nil && m.focused == 3 {
+			change = "  ctrl+t outside the table to change"
+		}
+		typeLine := keyStyle.Render("Type:") + " " + bodyTypeLabels[m.bodyType] + placeholderStyle.Render(change)
+		if hint := bodyTypeHints[m.bodyType]; hint != "" {
+			typeLine += placeholderStyle.Render(", " + hint)
+		}
+		editor = ansi.Truncate(typeLine, tabContentWidth-2, "…") + "\n" + editor
+	}
+	if m.activeTab == authTab {
+		if m.auth.Type == authNone {
+			editor = ""
+		}
+		typeLine := keyStyle.Render("Type:") + " " + authTypeLabels[m.auth.Type] + placeholderStyle.Render("  ctrl+t to change")
+		if m.auth.Type == authOAuth2 {
+			typeLine += placeholderStyle.Render(", ctrl+x to forget the token")
+		} else if hint := authTypeHints[m.auth.Type]; hint != "" {
+			typeLine += placeholderStyle.Render(", " + hint)
+		}
+		if m.auth.Type == authOAuth2 {
+			tokenLine := keyStyle.Render("Token:") + " " + oauthStatus(m.oauthToken)
+			editor = ansi.Truncate(tokenLine, tabContentWidth-2, "…") + "\n" + editor
+		}
+		editor = ansi.Truncate(typeLine, tabContentWidth-2, "…") + "\n" + editor
+	}
 	tabContent := lipgloss.NewStyle().
 		Width(tabContentWidth - 2).
-		Height(m.height - 8).
-		Render(m.tabContent[m.activeTab].View())
+		Height(m.height - 9).
+		Render(editor)
+
+	// Placeholders of the URL and the tab being edited, with their values
+	var edited []string
+	switch {
+	case table != nil:
+		edited = table.Rows().texts()
+	case m.activeTab == bodyTab:
+		edited = bodyTexts(m.request())
+	case m.activeTab == authTab:
+		edited = m.request().Auth.texts()
+	}
+	bar := placeholderBar(currentVariables(), m.urlField.Value(), m.focused == 2, edited...)
+	bar = ansi.Truncate(strings.ReplaceAll(bar, "\n", " "), tabContentWidth-2, "…")
 
-	combined := lipgloss.JoinVertical(lipgloss.Left, tabRow, tabContent)
+	combined := lipgloss.JoinVertical(lipgloss.Left, requestTabRow, tabContent, bar)
 
 	// Now, wrap the entire combined layout in a border.
 	finalPanel := tabStyle.Render(combined)
@@ -409,10 +662,17 @@ func (m Model) View() string {
 	doc.WriteString(finalPanel)
 	requestPanel := doc.String()
 
-	m.responseViewport.Height = m.height - 7
+	m.responseViewport.Height = m.height - 9
 	m.responseViewport.Width = m.width - tabContentWidth - 2
 
-	responsePanel := borderStyle.Width(m.width - tabContentWidth - 2).Height(m.height - 6).Render(titleStyle.Render(" Response: ") + headingStyle.Render(m.status) + "\n" + m.responseViewport.View())
+	responseTabRow := tabRow(m.responseTabs, m.activeResponseTab, m.width-tabContentWidth-4)
+
+	var timingSummary string
+	if m.timings != nil {
+		timingSummary = timingStyle.Render(m.timings.summary())
+	}
+
+	responsePanel := borderStyle.Width(m.width - tabContentWidth - 2).Height(m.height - 6).Render(titleStyle.Render(" Response: ") + headingStyle.Render(m.status) + timingSummary + "\n" + responseTabRow + "\n" + m.responseViewport.View())
 	mainPanel := lipgloss.JoinHorizontal(lipgloss.Left, requestPanel, responsePanel)
 
 	nameStyle := borderStyle
@@ -449,12 +709,19 @@ func (m Model) View() string {
 
 	body := lipgloss.JoinVertical(lipgloss.Top, topPanel, mainPanel)
 
+	activeEnv := m.environment
+	if activeEnv == "" {
+		activeEnv = "none"
+	}
+	envIndicator := m.styles.HeaderDecoration.Render("env: " + activeEnv)
+
 	if m.loading {
 		spinnerView := m.spinner.View()
 		footer = spinnerView + m.appBoundaryMessage(m.message)
 	} else {
 		footer = m.appBoundaryMessage(m.message)
 	}
+	footer = ansi.Truncate(footer, m.width-lipgloss.Width(envIndicator), "") + envIndicator
 
 	return m.styles.Base.Render(body + "\n" + footer)
 }
@@ -462,8 +729,85 @@ func (m Model) View() string {
 func (m *Model) sizeInputs() {
 	for i := range m.tabContent {
 		m.tabContent[i].SetWidth(int(float64(m.width)*0.5) - 2)
-		m.tabContent[i].SetHeight(m.height - 8)
+		m.tabContent[i].SetHeight(m.height - 9)
+	}
+	m.paramsTable.SetSize(int(float64(m.width)*0.5)-2, m.height-9)
+	m.headersTable.SetSize(int(float64(m.width)*0.5)-2, m.height-9)
+	// The Body tab starts with a line showing the body type
+	m.tabContent[bodyTab].SetHeight(m.height - 10)
+	m.tabContent[binaryContent].SetHeight(m.height - 10)
+	m.formTable.SetSize(int(float64(m.width)*0.5)-2, m.height-10)
+	m.authTable.SetSize(int(float64(m.width)*0.5)-2, m.height-10)
+	m.responseViewport.Width = m.width - int(float64(m.width)*0.5) - 2
+	m.responseViewport.Height = m.height - 9
+}
+
+// contentIndex is the textarea shown in the active request tab.
+func (m Model) contentIndex() int {
+	if m.activeTab == scriptsTab && m.showPostScript {
+		return postScriptContent
+	}
+	if m.activeTab == bodyTab && m.bodyType == bodyBinary {
+		return binaryContent
+	}
+	return m.activeTab
+}
+
+// loadOAuthToken reads the cached token of the OAuth 2.0 auth being edited
+// for the Auth tab.
+func (m *Model) loadOAuthToken() {
+	m.oauthToken = nil
+	r := m.request()
+	if r.Auth == nil || r.Auth.Type != authOAuth2 {
+		return
+	}
+	if token, ok := cachedToken(oauthSettings(r.Auth, currentVariables())); ok {
+		m.oauthToken = &token
+	}
+}
+
+// table is the table editor of the active request tab, or nil when the tab
+// is edited as text.
+func (m *Model) table() *kvTable {
+	switch m.activeTab {
+	case paramsTab:
+		return &m.paramsTable
+	case headersTab:
+		return &m.headersTable
+	case bodyTab:
+		if m.bodyType == bodyForm || m.bodyType == bodyMultipart {
+			m.formTable.typed = m.bodyType == bodyMultipart
+			return &m.formTable
+		}
+	case authTab:
+		if m.auth.Type != authNone {
+			return &m.authTable
+		}
 	}
+	return nil
+}
+
+// syncParamsFromURL copies the query string typed in the URL field into the
+// Params tab.
+func (m *Model) syncParamsFromURL() {
+	_, query, _ := splitURL(m.urlField.Value())
+	m.paramsTable.SetRows(m.paramsTable.Rows().withQuery(parseQuery(query)))
+}
+
+// syncURLFromParams rewrites the query string of the URL field from the
+// Params tab, escaped the way it is sent.
+func (m *Model) syncURLFromParams() {
+	base, _, fragment := splitURL(m.urlField.Value())
+	if query := displayQuery(m.paramsTable.Rows()); query != "" {
+		base += "?" + query
+	}
+	m.urlField.SetValue(base + fragment)
+}
+
+// refreshResponse loads the active response tab into the response viewport.
+func (m *Model) refreshResponse() {
+	m.responseViewport.SetContent(wordwrap.String(m.responseContent(), m.responseViewport.Width))
+	m.responseViewport.GotoTop()
 }
 
 // applyAutoComplete tries to complete the current field from history. Repeated triggers cycle through matches.
@@ -476,6 +820,7 @@ func (m Model) applyAutoComplete(field string) Model {
 		m.nameField.SetValue(pick)
 	} else {
 		m.urlField.SetValue(pick)
+		m.syncParamsFromURL()
 	}
 	m.autoCompleteField = field
 	// don't cycle indices with inline accept; keep index at 0
@@ -0,0 +1,445 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// OAuth 2.0 grant types, as sent in grant_type.
+const (
+	grantClientCredentials = "client_credentials"
+	grantPassword          = "password"
+	grantRefreshToken      = "refresh_token"
+	grantAuthorizationCode = "authorization_code"
+)
+
+// oauthToken is an access token as cached between sends.
+type oauthToken struct {
+	AccessToken  string    `json:"accessToken"`
+	TokenType    string    `json:"tokenType,omitempty"`
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// valid reports whether the token can still be sent, leaving a little time
+// for the request to arrive.
+func (t oauthToken) valid() bool {
+	return t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Add(30*time.Second).Before(t.Expiry))
+}
+
+// oauthUse describes the token sent with a request, for the Info tab.
+type oauthUse struct {
+	// source is "cached", "refreshed" or "new"
+	source string
+	grant  string
+	token  oauthToken
+	// retried is set when a 401 made the token be fetched again
+	retried bool
+}
+
+var tokenFilePath = filepath.Join(appFolder, "oauth2_tokens.json")
+
+// tokensMu serialises access to the token cache file.
+var tokensMu sync.Mutex
+
+// openBrowser opens the authorization page of the authorization code grant.
+var openBrowser = func(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// tokenKey names the cached token of a resolved Auth. Settings that would
+// give a different token give a different key, the client secret and
+// password included, so a token isn't reused once they are changed.
+func tokenKey(a Auth) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{a.Grant, a.TokenURL, a.AuthURL, a.ClientID, a.ClientSecret, a.Scope, a.Username, a.Password, a.RefreshToken}, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func readTokens() map[string]oauthToken {
+	tokens := map[string]oauthToken{}
+	data, err := os.ReadFile(tokenFilePath)
+	if err == nil {
+		_ = json.Unmarshal(data, &tokens)
+	}
+	return tokens
+}
+
+// cachedToken returns the cached token of a resolved Auth.
+func cachedToken(a Auth) (oauthToken, bool) {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	token, ok := readTokens()[tokenKey(a)]
+	return token, ok
+}
+
+// storeToken caches the token of a resolved Auth, or forgets it when token
+// is nil. Tokens are secrets, so the file is only readable by its owner.
+func storeToken(a Auth, token *oauthToken) error {
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	// The package's delete shadows the builtin, so forgotten tokens are
+	// left out instead
+	tokens := map[string]oauthToken{}
+	for key, cached := range readTokens() {
+		if key != tokenKey(a) {
+			tokens[key] = cached
+		}
+	}
+	if token != nil {
+		tokens[tokenKey(a)] = *token
+	}
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(appFolder, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return os.WriteFile(tokenFilePath, data, 0600)
+}
+
+// authorizeOAuth2 gets the access token of a request using OAuth 2.0 auth
+// and returns the request carrying it. The cached token is used while it is
+// valid and refreshed once it expires; force fetches a new one regardless.
+// Other requests are returned as they are, with a nil oauthUse.
+func authorizeOAuth2(ctx context.Context, client *http.Client, r Request, variables map[string]string, force bool) (Request, *oauthUse, error) {
+	if r.Auth == nil || r.Auth.Type != authOAuth2 {
+		return r, nil, nil
+	}
+	a := oauthSettings(r.Auth, variables)
+	use := &oauthUse{grant: a.Grant}
+	cached, ok := cachedToken(a)
+	switch {
+	case ok && cached.valid() && !force:
+		use.source, use.token = "cached", cached
+	case ok && cached.RefreshToken != "":
+		token, err := requestToken(ctx, client, a, url.Values{
+			"grant_type":    {grantRefreshToken},
+			"refresh_token": {cached.RefreshToken},
+		})
+		if err == nil {
+			if token.RefreshToken == "" {
+				token.RefreshToken = cached.RefreshToken
+			}
+			use.source, use.token = "refreshed", token
+			break
+		}
+		// An expired or revoked refresh token falls back to the grant
+		fallthrough
+	default:
+		token, err := grantToken(ctx, client, a)
+		if err != nil {
+			return r, nil, err
+		}
+		use.source, use.token = "new", token
+	}
+	if use.source != "cached" {
+		// A token that can't be cached is still sent
+		_ = storeToken(a, &use.token)
+	}
+
+	auth := *r.Auth
+	auth.Token = use.token.AccessToken
+	r.Auth = &auth
+	return r, use, nil
+}
+
+// oauthSettings resolves the OAuth 2.0 settings of a, which default to the
+// client credentials grant.
+func oauthSettings(a *Auth, variables map[string]string) Auth {
+	settings := a.resolved(func(s string) string {
+		return replacePlaceholders(s, variables)
+	})
+	settings.Grant = strings.TrimSpace(settings.Grant)
+	if settings.Grant == "" {
+		settings.Grant = grantClientCredentials
+	}
+	return settings
+}
+
+// withCachedToken returns r carrying its cached OAuth 2.0 token while it is
+// valid, for exports that don't fetch one.
+func withCachedToken(r Request, variables map[string]string) Request {
+	if r.Auth == nil || r.Auth.Type != authOAuth2 {
+		return r
+	}
+	if token, ok := cachedToken(oauthSettings(r.Auth, variables)); ok && token.valid() {
+		auth := *r.Auth
+		auth.Token = token.AccessToken
+		r.Auth = &auth
+	}
+	return r
+}
+
+// grantToken fetches a new token with the grant of a resolved Auth.
+func grantToken(ctx context.Context, client *http.Client, a Auth) (oauthToken, error) {
+	if strings.TrimSpace(a.TokenURL) == "" {
+		return oauthToken{}, fmt.Errorf("the Token URL is empty")
+	}
+	form := url.Values{"grant_type": {a.Grant}}
+	switch a.Grant {
+	case grantClientCredentials:
+	case grantPassword:
+		form.Set("username", a.Username)
+		form.Set("password", a.Password)
+	case grantRefreshToken:
+		if a.RefreshToken == "" {
+			return oauthToken{}, fmt.Errorf("the Refresh token is empty")
+		}
+		form.Set("refresh_token", a.RefreshToken)
+	case grantAuthorizationCode:
+		return authorizationCode(ctx, client, a)
+	default:
+		return oauthToken{}, fmt.Errorf("unsupported grant %q, use client_credentials, password, refresh_token or authorization_code", a.Grant)
+	}
+	return requestToken(ctx, client, a, form)
+}
+
+// requestToken posts form to the token endpoint. Confidential clients
+// authenticate with Basic auth, public ones send their client_id.
+func requestToken(ctx context.Context, client *http.Client, a Auth, form url.Values) (oauthToken, error) {
+	if a.Scope != "" && form.Get("grant_type") != grantAuthorizationCode {
+		form.Set("scope", a.Scope)
+	}
+	if a.ClientSecret == "" {
+		form.Set("client_id", a.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSpace(a.TokenURL), strings.NewReader(form.Encode()))
+	if err != nil {
+		return oauthToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if a.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return oauthToken{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return oauthToken{}, err
+	}
+
+	// Most servers answer JSON, some such as GitHub's a form
+	fields := map[string]any{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		values, formErr := url.ParseQuery(string(body))
+		if formErr != nil || !strings.Contains(string(body), "=") {
+			if resp.StatusCode < 300 {
+				return oauthToken{}, fmt.Errorf("the token response isn't JSON: %s", ansi.Truncate(string(body), 200, "…"))
+			}
+			values = nil
+		}
+		for key := range values {
+			fields[key] = values.Get(key)
+		}
+	}
+	text := func(key string) string {
+		switch v := fields[key].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return ""
+	}
+
+	if resp.StatusCode >= 300 || text("error") != "" {
+		message := resp.Status
+		if e := text("error"); e != "" {
+			message += ": " + e
+		}
+		if d := text("error_description"); d != "" {
+			message += ", " + d
+		}
+		if text("error") == "" && len(body) > 0 {
+			message += ": " + ansi.Truncate(string(body), 200, "…")
+		}
+		return oauthToken{}, fmt.Errorf("the token request failed with %s", message)
+	}
+
+	token := oauthToken{
+		AccessToken:  text("access_token"),
+		TokenType:    text("token_type"),
+		RefreshToken: text("refresh_token"),
+		Scope:        text("scope"),
+	}
+	if token.AccessToken == "" {
+		return oauthToken{}, fmt.Errorf("the token response has no access_token")
+	}
+	if seconds, err := strconv.ParseFloat(text("expires_in"), 64); err == nil && seconds > 0 {
+		token.Expiry = time.Now().Add(time.Duration(seconds * float64(time.Second)))
+	}
+	return token, nil
+}
+
+// authorizationCode runs the authorization code grant with PKCE. The
+// authorization page is opened in the browser, and a listener on localhost
+// receives the code it redirects back with.
+func authorizationCode(ctx context.Context, client *http.Client, a Auth) (oauthToken, error) {
+	if strings.TrimSpace(a.AuthURL) == "" {
+		return oauthToken{}, fmt.Errorf("the Auth URL is empty")
+	}
+	authURL, err := url.Parse(strings.TrimSpace(a.AuthURL))
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("invalid Auth URL: %w", err)
+	}
+
+	address, path := "127.0.0.1:0", "/callback"
+	if a.RedirectURI != "" {
+		redirect, err := url.Parse(a.RedirectURI)
+		if err != nil || redirect.Port() == "" || (redirect.Hostname() != "localhost" && net.ParseIP(redirect.Hostname()) == nil) {
+			return oauthToken{}, fmt.Errorf("the Redirect URI has to be on this machine with a port, such as http://localhost:8765/callback")
+		}
+		address, path = redirect.Host, redirect.Path
+		if path == "" {
+			path = "/"
+		}
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("failed to listen for the redirect: %w", err)
+	}
+	redirectURI := a.RedirectURI
+	if redirectURI == "" {
+		redirectURI = "http://" + listener.Addr().String() + path
+	}
+
+	verifier := randomText(32)
+	challenge := sha256.Sum256([]byte(verifier))
+	state := randomText(16)
+
+	callbacks := make(chan url.Values, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		select {
+		case callbacks <- query:
+		default:
+		}
+		if e := query.Get("error"); e != "" {
+			fmt.Fprintf(w, "Authorization failed: %s %s", e, query.Get("error_description"))
+			return
+		}
+		fmt.Fprint(w, "Gostman received the authorization, this tab can be closed.")
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", a.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	if a.Scope != "" {
+		query.Set("scope", a.Scope)
+	}
+	query.Set("state", state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	if err := openBrowser(authURL.String()); err != nil {
+		// Without a browser the page can still be opened by hand
+		_ = clipboard.WriteAll(authURL.String())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	var callback url.Values
+	select {
+	case <-ctx.Done():
+		return oauthToken{}, fmt.Errorf("no authorization received from the browser: %w", ctx.Err())
+	case callback = <-callbacks:
+	}
+
+	if e := callback.Get("error"); e != "" {
+		return oauthToken{}, fmt.Errorf("authorization failed: %s %s", e, callback.Get("error_description"))
+	}
+	if callback.Get("state") != state {
+		return oauthToken{}, fmt.Errorf("the authorization response has the wrong state")
+	}
+	return requestToken(ctx, client, a, url.Values{
+		"grant_type":    {grantAuthorizationCode},
+		"code":          {callback.Get("code")},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+}
+
+// randomText returns n random bytes as URL safe text.
+func randomText(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// oauthStatus describes a cached token for the Auth tab, nil when there is
+// none.
+func oauthStatus(token *oauthToken) string {
+	if token == nil {
+		return "no token yet, one is fetched when the request is sent"
+	}
+	return tokenSummary(*token)
+}
+
+// tokenSummary shows a token shortened, with when it expires.
+func tokenSummary(token oauthToken) string {
+	parts := []string{ansi.Truncate(token.AccessToken, 16, "…")}
+	if token.TokenType != "" {
+		parts = append(parts, token.TokenType)
+	}
+	switch {
+	case token.Expiry.IsZero():
+		parts = append(parts, "no expiry")
+	case token.valid():
+		parts = append(parts, "expires in "+time.Until(token.Expiry).Round(time.Second).String())
+	default:
+		parts = append(parts, "expired")
+	}
+	if token.Scope != "" {
+		parts = append(parts, "scope "+token.Scope)
+	}
+	if token.RefreshToken != "" {
+		parts = append(parts, "refreshable")
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenServer is a fake authorization server that hands out access-1,
+// access-2 and so on, and records the token requests it gets.
+type tokenServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []tokenRequest
+	// check, when set, can refuse a request with an OAuth error
+	check func(form url.Values) string
+}
+
+type tokenRequest struct {
+	form             url.Values
+	user, secret     string
+	hasBasicAuth     bool
+	contentType      string
+	acceptsJSONReply bool
+}
+
+func newTokenServer(t *testing.T) *tokenServer {
+	t.Helper()
+	s := &tokenServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		user, secret, ok := r.BasicAuth()
+		s.mu.Lock()
+		s.requests = append(s.requests, tokenRequest{
+			form:             r.PostForm,
+			user:             user,
+			secret:           secret,
+			hasBasicAuth:     ok,
+			contentType:      r.Header.Get("Content-Type"),
+			acceptsJSONReply: r.Header.Get("Accept") == "application/json",
+		})
+		n := len(s.requests)
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if s.check != nil {
+			if e := s.check(r.PostForm); e != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": e})
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access-" + string(rune('0'+n)),
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "refresh-" + string(rune('0'+n)),
+		})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *tokenServer) received() []tokenRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]tokenRequest(nil), s.requests...)
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	useTempData(t)
+	tokens := newTokenServer(t)
+	api, got := recordingServer(t)
+
+	r := Request{
+		Method: "GET",
+		URL:    api.URL,
+		Auth:   &Auth{Type: authOAuth2, Grant: grantClientCredentials, TokenURL: tokens.URL, ClientID: "{{client}}", ClientSecret: "s3cret", Scope: "read"},
+	}
+	variables := map[string]string{"client": "cli"}
+	res := execute(context.Background(), r, "", variables)
+	if res.statusCode != http.StatusOK {
+		t.Fatalf("status = %q, body %q", res.status, res.body)
+	}
+	if v := got.header.Get("Authorization"); v != "Bearer access-1" {
+		t.Errorf("Authorization = %q", v)
+	}
+	if res.oauth == nil || res.oauth.source != "new" {
+		t.Errorf("oauth = %+v, want a new token", res.oauth)
+	}
+
+	sent := tokens.received()
+	if len(sent) != 1 {
+		t.Fatalf("%d token requests, want 1", len(sent))
+	}
+	tr := sent[0]
+	if tr.form.Get("grant_type") != grantClientCredentials || tr.form.Get("scope") != "read" {
+		t.Errorf("token form = %v", tr.form)
+	}
+	// A confidential client authenticates with Basic auth only
+	if !tr.hasBasicAuth || tr.user != "cli" || tr.secret != "s3cret" || tr.form.Has("client_id") {
+		t.Errorf("client authentication = %q:%q, form %v", tr.user, tr.secret, tr.form)
+	}
+	if tr.contentType != "application/x-www-form-urlencoded" || !tr.acceptsJSONReply {
+		t.Errorf("Content-Type = %q, JSON accepted %v", tr.contentType, tr.acceptsJSONReply)
+	}
+
+	// The cached token is sent until it expires
+	res = execute(context.Background(), r, "", variables)
+	if res.oauth == nil || res.oauth.source != "cached" || len(tokens.received()) != 1 {
+		t.Errorf("second send oauth = %+v after %d token requests", res.oauth, len(tokens.received()))
+	}
+	if v := got.header.Get("Authorization"); v != "Bearer access-1" {
+		t.Errorf("Authorization = %q", v)
+	}
+}
+
+func TestOAuth2Password(t *testing.T) {
+	useTempData(t)
+	tokens := newTokenServer(t)
+	api, got := recordingServer(t)
+
+	r := Request{
+		Method: "GET",
+		URL:    api.URL,
+		Auth:   &Auth{Type: authOAuth2, Grant: grantPassword, TokenURL: tokens.URL, ClientID: "public", Username: "ada", Password: "{{password}}"},
+	}
+	res := execute(context.Background(), r, "", map[string]string{"password": "hunter2"})
+	if res.statusCode != http.StatusOK {
+		t.Fatalf("status = %q, body %q", res.status, res.body)
+	}
+	if v := got.header.Get("Authorization"); v != "Bearer access-1" {
+		t.Errorf("Authorization = %q", v)
+	}
+	tr := tokens.received()[0]
+	want := url.Values{"grant_type": {grantPassword}, "username": {"ada"}, "password": {"hunter2"}, "client_id": {"public"}}
+	if tr.form.Encode() != want.Encode() || tr.hasBasicAuth {
+		t.Errorf("token form = %v, Basic auth %v", tr.form, tr.hasBasicAuth)
+	}
+
+	// Another password is another token
+	res = execute(context.Background(), r, "", map[string]string{"password": "changed"})
+	if res.oauth == nil || res.oauth.source != "new" || len(tokens.received()) != 2 {
+		t.Errorf("oauth after changing the password = %+v", res.oauth)
+	}
+}
+
+func TestOAuth2AuthorizationCodeWithPKCE(t *testing.T) {
+	useTempData(t)
+	tokens := newTokenServer(t)
+	api, got := recordingServer(t)
+
+	// The browser approves straight away, redirecting back with a code
+	var challenge string
+	browser := openBrowser
+	openBrowser = func(page string) error {
+		u, err := url.Parse(page)
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		if q.Get("response_type") != "code" || q.Get("client_id") != "app" || q.Get("scope") != "profile" || q.Get("code_challenge_method") != "S256" {
+			t.Errorf("authorization page = %s", page)
+		}
+		challenge = q.Get("code_challenge")
+		go func() {
+			resp, err := http.Get(q.Get("redirect_uri") + "?code=the-code&state=" + url.QueryEscape(q.Get("state")))
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+	t.Cleanup(func() { openBrowser = browser })
+
+	r := Request{
+		Method: "GET",
+		URL:    api.URL,
+		Auth:   &Auth{Type: authOAuth2, Grant: grantAuthorizationCode, TokenURL: tokens.URL, AuthURL: "https://auth.example.com/authorize", ClientID: "app", Scope: "profile"},
+	}
+	res := execute(context.Background(), r, "", nil)
+	if res.statusCode != http.StatusOK {
+		t.Fatalf("status = %q, body %q", res.status, res.body)
+	}
+	if v := got.header.Get("Authorization"); v != "Bearer access-1" {
+		t.Errorf("Authorization = %q", v)
+	}
+
+	form := tokens.received()[0].form
+	if form.Get("grant_type") != grantAuthorizationCode || form.Get("code") != "the-code" || form.Get("client_id") != "app" || form.Get("redirect_uri") == "" {
+		t.Errorf("token form = %v", form)
+	}
+	sum := sha256.Sum256([]byte(form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+		t.Errorf("code_verifier %q doesn't match the challenge %q", form.Get("code_verifier"), challenge)
+	}
+}
+
+func TestOAuth2AuthorizationCodeChecksState(t *testing.T) {
+	useTempData(t)
+	browser := openBrowser
+	openBrowser = func(page string) error {
+		u, _ := url.Parse(page)
+		go func() {
+			resp, err := http.Get(u.Query().Get("redirect_uri") + "?code=the-code&state=forged")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+	t.Cleanup(func() { openBrowser = browser })
+
+	a := Auth{Type: authOAuth2, Grant: grantAuthorizationCode, TokenURL: "http://127.0.0.1:1", AuthURL: "https://auth.example.com/authorize", ClientID: "app"}
+	if _, err := grantToken(context.Background(), http.DefaultClient, a); err == nil {
+		t.Error("a redirect with the wrong state was accepted")
+	}
+}
+
+func TestOAuth2RefreshesExpiredToken(t *testing.T) {
+	useTempData(t)
+	tokens := newTokenServer(t)
+	api, got := recordingServer(t)
+
+	auth := &Auth{Type: authOAuth2, Grant: grantClientCredentials, TokenURL: tokens.URL, ClientID: "cli", ClientSecret: "s3cret"}
+	expired := oauthToken{AccessToken: "old", RefreshToken: "keep-me", Expiry: time.Now().Add(-time.Minute)}
+	if err := storeToken(oauthSettings(auth, nil), &expired); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens.check = func(form url.Values) string {
+		if form.Get("grant_type") != grantRefreshToken || form.Get("refresh_token") != "keep-me" {
+			return "invalid_grant"
+		}
+		return ""
+	}
+	res := execute(context.Background(), Request{Method: "GET", URL: api.URL, Auth: auth}, "", nil)
+	if res.oauth == nil || res.oauth.source != "refreshed" {
+		t.Fatalf("oauth = %+v, body %q", res.oauth, res.body)
+	}
+	if v := got.header.Get("Authorization"); v != "Bearer access-1" {
+		t.Errorf("Authorization = %q", v)
+	}
+
+	// A revoked refresh token falls back to the grant
+	tokens.check = func(form url.Values) string {
+		if form.Get("grant_type") == grantRefreshToken {
+			return "invalid_grant"
+		}
+		return ""
+	}
+	if err := storeToken(oauthSettings(auth, nil), &expired); err != nil {
+		t.Fatal(err)
+	}
+	res = execute(context.Background(), Request{Method: "GET", URL: api.URL, Auth: auth}, "", nil)
+	if res.oauth == nil || res.oauth.source != "new" {
+		t.Errorf("oauth after a refused refresh = %+v, body %q", res.oauth, res.body)
+	}
+}
+
+func TestOAuth2RetriesOnceAfter401(t *testing.T) {
+	useTempData(t)
+	tokens := newTokenServer(t)
+	var attempts []string
+	refuseAll := false
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts = append(attempts, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "Bearer revoked" || refuseAll {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(api.Close)
+
+	auth := &Auth{Type: authOAuth2, TokenURL: tokens.URL, ClientID: "cli", ClientSecret: "s3cret"}
+	revoked := oauthToken{AccessToken: "revoked", Expiry: time.Now().Add(time.Hour)}
+	if err := storeToken(oauthSettings(auth, nil), &revoked); err != nil {
+		t.Fatal(err)
+	}
+
+	res := execute(context.Background(), Request{Method: "GET", URL: api.URL, Auth: auth}, "", nil)
+	if res.statusCode != http.StatusOK {
+		t.Fatalf("status = %q", res.status)
+	}
+	if len(attempts) != 2 || attempts[1] != "Bearer access-1" {
+		t.Errorf("attempts = %q", attempts)
+	}
+	if res.oauth == nil || !res.oauth.retried || res.oauth.source != "new" {
+		t.Errorf("oauth = %+v", res.oauth)
+	}
+	if token, ok := cachedToken(oauthSettings(auth, nil)); !ok || token.AccessToken != "access-1" {
+		t.Errorf("cached token = %+v", token)
+	}
+
+	// A new token that is refused isn't fetched again
+	refuseAll = true
+	if err := storeToken(oauthSettings(auth, nil), nil); err != nil {
+		t.Fatal(err)
+	}
+	res = execute(context.Background(), Request{Method: "GET", URL: api.URL, Auth: auth}, "", nil)
+	if res.statusCode != http.StatusUnauthorized || res.oauth.retried || len(tokens.received()) != 2 {
+		t.Errorf("status %q, oauth %+v after %d token requests", res.status, res.oauth, len(tokens.received()))
+	}
+}
+
+func TestTokenKeyCoversSecrets(t *testing.T) {
+	a := Auth{Grant: grantPassword, TokenURL: "https://auth.example.com/token", ClientID: "cli", ClientSecret: "one", Username: "ada", Password: "first"}
+	b := a
+	b.ClientSecret = "two"
+	c := a
+	c.Password = "second"
+	if tokenKey(a) == tokenKey(b) || tokenKey(a) == tokenKey(c) {
+		t.Error("tokens are shared across client secrets or passwords")
+	}
+}
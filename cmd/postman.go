@@ -0,0 +1,605 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// postmanCollection is the subset of the Postman Collection v2.1 format that
+// maps onto gostman requests.
+type postmanCollection struct {
+	Info     postmanInfo       `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanKeyValue `json:"variable,omitempty"`
+}
+
+type postmanInfo struct {
+	PostmanID string `json:"_postman_id,omitempty"`
+	Name      string `json:"name"`
+	Schema    string `json:"schema"`
+}
+
+// postmanItem is either a folder, holding more items, or a request.
+type postmanItem struct {
+	ID      string          `json:"id,omitempty"`
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item,omitempty"`
+	Request *postmanRequest `json:"request,omitempty"`
+}
+
+type postmanRequest struct {
+	Method string            `json:"method"`
+	Header []postmanKeyValue `json:"header"`
+	Body   *postmanBody      `json:"body,omitempty"`
+	URL    postmanURL        `json:"url"`
+	Auth   *postmanAuth      `json:"auth,omitempty"`
+}
+
+type postmanKeyValue struct {
+	Key         string             `json:"key"`
+	Value       string             `json:"value"`
+	Type        string             `json:"type,omitempty"`
+	Src         string             `json:"src,omitempty"`
+	Disabled    bool               `json:"disabled,omitempty"`
+	Description postmanDescription `json:"description,omitempty"`
+}
+
+// postmanDescription is written as a string but may be read from an object
+// holding its content.
+type postmanDescription string
+
+func (d *postmanDescription) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*d = postmanDescription(text)
+		return nil
+	}
+	var object struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	*d = postmanDescription(object.Content)
+	return nil
+}
+
+type postmanBody struct {
+	Mode       string            `json:"mode"`
+	Raw        string            `json:"raw,omitempty"`
+	URLEncoded []postmanKeyValue `json:"urlencoded,omitempty"`
+	FormData   []postmanKeyValue `json:"formdata,omitempty"`
+	File       *postmanFile      `json:"file,omitempty"`
+	Options    *postmanOptions   `json:"options,omitempty"`
+}
+
+type postmanFile struct {
+	Src string `json:"src"`
+}
+
+type postmanOptions struct {
+	Raw struct {
+		Language string `json:"language"`
+	} `json:"raw"`
+}
+
+// postmanURL is written as an object but may be read from a plain string.
+type postmanURL struct {
+	Raw   string            `json:"raw"`
+	Query []postmanKeyValue `json:"query,omitempty"`
+}
+
+func (u *postmanURL) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		u.Raw = raw
+		return nil
+	}
+	type plain postmanURL
+	return json.Unmarshal(data, (*plain)(u))
+}
+
+type postmanAuth struct {
+	Type   string             `json:"type"`
+	Basic  []postmanAuthParam `json:"basic,omitempty"`
+	Bearer []postmanAuthParam `json:"bearer,omitempty"`
+	APIKey []postmanAuthParam `json:"apikey,omitempty"`
+	Digest []postmanAuthParam `json:"digest,omitempty"`
+	OAuth2 []postmanAuthParam `json:"oauth2,omitempty"`
+	AWSv4  []postmanAuthParam `json:"awsv4,omitempty"`
+}
+
+type postmanAuthParam struct {
+	Key   string      `json:"key"`
+	Value postmanText `json:"value"`
+	Type  string      `json:"type,omitempty"`
+}
+
+// postmanText is written as a string but may be read from any JSON value,
+// such as the booleans among OAuth 2.0 settings.
+type postmanText string
+
+func (t *postmanText) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		text = string(data)
+	}
+	*t = postmanText(text)
+	return nil
+}
+
+// postmanGrants maps the OAuth 2.0 grant types of Postman to grant_type.
+var postmanGrants = map[string]string{
+	"client_credentials":           grantClientCredentials,
+	"password_credentials":         grantPassword,
+	"authorization_code":           grantAuthorizationCode,
+	"authorization_code_with_pkce": grantAuthorizationCode,
+}
+
+// postmanEnvironment is the format Postman uses to export an environment.
+type postmanEnvironment struct {
+	Name   string `json:"name"`
+	Values []struct {
+		Key     string `json:"key"`
+		Value   string `json:"value"`
+		Enabled *bool  `json:"enabled"`
+	} `json:"values"`
+}
+
+// importPostman adds a Postman v2.1 collection or a Postman environment to
+// saved and returns a summary of what was imported. Folders are kept in each
+// request's Folder, and collection variables are added to the globals
+// without overriding variables that already exist.
+func importPostman(data []byte, saved *SavedData) (string, error) {
+	var probe struct {
+		Info   *postmanInfo     `json:"info"`
+		Values *json.RawMessage `json:"values"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return "", fmt.Errorf("not a Postman file: %w", err)
+	}
+
+	if probe.Info == nil && probe.Values != nil {
+		var env postmanEnvironment
+		if err := json.Unmarshal(data, &env); err != nil {
+			return "", fmt.Errorf("invalid Postman environment: %w", err)
+		}
+		return importPostmanEnvironment(env, saved)
+	}
+
+	if probe.Info == nil {
+		return "", fmt.Errorf("not a Postman collection or environment")
+	}
+	if probe.Info.Schema != "" && !strings.Contains(probe.Info.Schema, "v2.") {
+		return "", fmt.Errorf("unsupported collection schema %s, export it as v2.1", probe.Info.Schema)
+	}
+
+	var collection postmanCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return "", fmt.Errorf("invalid Postman collection: %w", err)
+	}
+
+	var requests []Request
+	var walk func(items []postmanItem, folder string) error
+	walk = func(items []postmanItem, folder string) error {
+		for _, item := range items {
+			if item.Request == nil {
+				if err := walk(item.Item, joinFolder(folder, item.Name)); err != nil {
+					return err
+				}
+				continue
+			}
+			r, err := fromPostman(item, folder)
+			if err != nil {
+				return fmt.Errorf("%s: %w", item.Name, err)
+			}
+			requests = append(requests, r)
+		}
+		return nil
+	}
+	if err := walk(collection.Item, collection.Info.Name); err != nil {
+		return "", err
+	}
+
+	for i := range requests {
+		requests[i].Id = uuid.New().String()
+	}
+	saved.Requests = append(saved.Requests, requests...)
+
+	added, err := mergeVariables(&saved.Variables, collection.Variable)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Imported %d requests and %d variables from %s", len(requests), added, collection.Info.Name), nil
+}
+
+func importPostmanEnvironment(env postmanEnvironment, saved *SavedData) (string, error) {
+	if env.Name == "" {
+		return "", fmt.Errorf("the environment has no name")
+	}
+
+	variables := make(map[string]string, len(env.Values))
+	for _, v := range env.Values {
+		if v.Enabled != nil && !*v.Enabled {
+			continue
+		}
+		variables[v.Key] = v.Value
+	}
+
+	imported := Environment{Name: env.Name, Variables: indentJSON(variables)}
+	if existing := saved.environment(env.Name); existing != nil {
+		*existing = imported
+	} else {
+		saved.Environments = append(saved.Environments, imported)
+	}
+
+	return fmt.Sprintf("Imported environment %s with %d variables", env.Name, len(variables)), nil
+}
+
+// mergeVariables adds enabled Postman variables to the raw JSON variables in
+// target, keeping the values of keys that already exist.
+func mergeVariables(target *string, values []postmanKeyValue) (int, error) {
+	variables, err := parseVariables(*target)
+	if err != nil {
+		return 0, fmt.Errorf("globals: %w", err)
+	}
+
+	added := 0
+	for _, v := range values {
+		if v.Disabled {
+			continue
+		}
+		if _, ok := variables[v.Key]; ok {
+			continue
+		}
+		variables[v.Key] = v.Value
+		added++
+	}
+	if added > 0 {
+		*target = indentJSON(variables)
+	}
+	return added, nil
+}
+
+func fromPostman(item postmanItem, folder string) (Request, error) {
+	p := item.Request
+
+	method := strings.ToUpper(p.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	r := Request{
+		Name:   item.Name,
+		Folder: folder,
+		Method: method,
+	}
+
+	// The raw URL carries the query string as well; Postman keeps disabled
+	// params only in the query list.
+	base, _, _ := strings.Cut(p.URL.Raw, "?")
+	r.URL = base
+
+	if len(p.URL.Query) > 0 {
+		r.QueryParams = fromPostmanKeyValues(p.URL.Query)
+	} else if _, rawQuery, ok := strings.Cut(p.URL.Raw, "?"); ok {
+		r.QueryParams = parseQuery(rawQuery)
+	}
+	headers := fromPostmanKeyValues(p.Header)
+
+	if p.Body != nil {
+		switch p.Body.Mode {
+		case "raw":
+			r.Body = p.Body.Raw
+			language := ""
+			if p.Body.Options != nil {
+				language = p.Body.Options.Raw.Language
+			}
+			switch language {
+			case "json":
+				r.BodyType = bodyJSON
+			case "xml", "html":
+				r.BodyType = bodyXML
+			case "text", "javascript":
+				r.BodyType = bodyText
+			default:
+				r.BodyType = inferBodyType(Request{Body: r.Body, Headers: headers})
+			}
+		case "urlencoded":
+			r.BodyType = bodyForm
+			r.Form = fromPostmanKeyValues(p.Body.URLEncoded)
+		case "formdata":
+			r.BodyType = bodyMultipart
+			for _, f := range p.Body.FormData {
+				kv := KeyValue{Key: f.Key, Value: f.Value, Disabled: f.Disabled, Description: string(f.Description)}
+				if f.Type == "file" {
+					kv.Value, kv.Type = f.Src, formFile
+				}
+				r.Form = append(r.Form, kv)
+			}
+		case "file":
+			r.BodyType = bodyBinary
+			if p.Body.File != nil {
+				r.BodyFile = p.Body.File.Src
+			}
+		}
+	}
+	if r.BodyType == "" {
+		r.BodyType = bodyNone
+	}
+
+	if p.Auth != nil {
+		r.Auth = fromPostmanAuth(p.Auth)
+	}
+	r.Headers = headers
+
+	return r, nil
+}
+
+// fromPostmanKeyValues turns Postman headers or query params into rows,
+// keeping disabled ones.
+func fromPostmanKeyValues(values []postmanKeyValue) KeyValues {
+	var rows KeyValues
+	for _, v := range values {
+		rows = append(rows, KeyValue{Key: v.Key, Value: v.Value, Disabled: v.Disabled, Description: string(v.Description)})
+	}
+	return rows
+}
+
+// toPostmanKeyValues turns rows into Postman headers or query params.
+func toPostmanKeyValues(rows KeyValues, kind string) []postmanKeyValue {
+	var values []postmanKeyValue
+	for _, kv := range rows {
+		values = append(values, postmanKeyValue{Key: kv.Key, Value: kv.Value, Type: kind, Disabled: kv.Disabled, Description: postmanDescription(kv.Description)})
+	}
+	return values
+}
+
+// params returns the parameters of the auth type, nil for types
+// that have no Auth equivalent.
+func (a *postmanAuth) params() *[]postmanAuthParam {
+	switch a.Type {
+	case authBasic:
+		return &a.Basic
+	case authBearer:
+		return &a.Bearer
+	case authAPIKey:
+		return &a.APIKey
+	case authDigest:
+		return &a.Digest
+	case authOAuth2:
+		return &a.OAuth2
+	case authAWSv4:
+		return &a.AWSv4
+	}
+	return nil
+}
+
+// fromPostmanAuth reads the parameters Postman keeps for an auth type, such
+// as username and password, into an Auth.
+func fromPostmanAuth(auth *postmanAuth) *Auth {
+	params := auth.params()
+	if params == nil {
+		return nil
+	}
+	a := Auth{Type: auth.Type}
+	for _, f := range authFields[a.Type] {
+		for _, v := range *params {
+			if v.Key == f.key {
+				*f.value(&a) = string(v.Value)
+			}
+		}
+	}
+	if grant, ok := postmanGrants[a.Grant]; ok && a.Type == authOAuth2 {
+		a.Grant = grant
+	}
+	return &a
+}
+
+func toPostmanAuth(a *Auth) *postmanAuth {
+	if a == nil {
+		return nil
+	}
+	auth := &postmanAuth{Type: a.Type}
+	params := auth.params()
+	if params == nil {
+		return nil
+	}
+	for _, f := range authFields[a.Type] {
+		value := *f.value(a)
+		if f.key == "grant_type" {
+			for postmanGrant, grant := range postmanGrants {
+				if grant == value && postmanGrant != "authorization_code" {
+					value = postmanGrant
+				}
+			}
+		}
+		*params = append(*params, postmanAuthParam{Key: f.key, Value: postmanText(value), Type: "string"})
+	}
+	return auth
+}
+
+func joinFolder(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
+
+// exportPostman writes the saved requests as a Postman v2.1 collection, with
+// folders rebuilt from each request's Folder and the global variables as
+// collection variables. Without a name, requests that all sit in one top
+// folder are exported as the collection of that name.
+func exportPostman(saved SavedData, name string) ([]byte, error) {
+	if name == "" {
+		name = commonFolder(saved.Requests)
+	}
+	if name == "" {
+		name = "Gostman"
+	}
+
+	collection := postmanCollection{
+		Info: postmanInfo{
+			PostmanID: uuid.New().String(),
+			Name:      name,
+			Schema:    postmanSchema,
+		},
+		Item: []postmanItem{},
+	}
+
+	// A folder named after the collection, as created by importPostman, is the
+	// collection itself.
+	prefix := name + "/"
+
+	for _, r := range saved.Requests {
+		item, err := toPostman(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+
+		folder := r.Folder
+		if folder == name {
+			folder = ""
+		}
+		folder = strings.TrimPrefix(folder, prefix)
+
+		items := &collection.Item
+		if folder != "" {
+			for _, part := range strings.Split(folder, "/") {
+				items = postmanFolder(items, part)
+			}
+		}
+		*items = append(*items, item)
+	}
+
+	variables, err := parseVariables(saved.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("globals: %w", err)
+	}
+	keys := make([]string, 0, len(variables))
+	for key := range variables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		collection.Variable = append(collection.Variable, postmanKeyValue{Key: key, Value: variables[key]})
+	}
+
+	return []byte(indentJSON(collection)), nil
+}
+
+// commonFolder returns the top folder shared by every request, if any.
+func commonFolder(requests []Request) string {
+	var common string
+	for i, r := range requests {
+		top, _, _ := strings.Cut(r.Folder, "/")
+		if top == "" || (i > 0 && top != common) {
+			return ""
+		}
+		common = top
+	}
+	return common
+}
+
+// postmanFolder returns the items of the folder called name within items,
+// creating the folder if needed.
+func postmanFolder(items *[]postmanItem, name string) *[]postmanItem {
+	for i := range *items {
+		if (*items)[i].Request == nil && (*items)[i].Name == name {
+			return &(*items)[i].Item
+		}
+	}
+	*items = append(*items, postmanItem{Name: name, Item: []postmanItem{}})
+	return &(*items)[len(*items)-1].Item
+}
+
+func toPostman(r Request) (postmanItem, error) {
+	p := &postmanRequest{
+		Method: strings.ToUpper(strings.TrimSpace(r.Method)),
+		Header: []postmanKeyValue{},
+		URL:    postmanURL{Query: toPostmanKeyValues(r.QueryParams, "")},
+		Auth:   toPostmanAuth(r.Auth),
+	}
+	p.Header = append(p.Header, toPostmanKeyValues(r.Headers, "text")...)
+
+	// Postman shows the raw URL unescaped, with its {{placeholders}}
+	raw := strings.TrimSpace(r.URL)
+	var query []string
+	for _, kv := range r.QueryParams.enabled() {
+		query = append(query, queryPair(kv, func(s string) string { return s }))
+	}
+	if len(query) > 0 {
+		separator := "?"
+		if strings.Contains(raw, "?") {
+			separator = "&"
+		}
+		raw += separator + strings.Join(query, "&")
+	}
+	p.URL.Raw = raw
+
+	p.Body = postmanRequestBody(r)
+
+	return postmanItem{ID: r.Id, Name: r.Name, Request: p}, nil
+}
+
+// postmanRequestBody writes the body of r in the Postman mode that matches
+// its body type.
+func postmanRequestBody(r Request) *postmanBody {
+	raw := func(language string) *postmanBody {
+		if r.Body == "" {
+			return nil
+		}
+		body := &postmanBody{Mode: "raw", Raw: r.Body, Options: &postmanOptions{}}
+		body.Options.Raw.Language = language
+		return body
+	}
+
+	switch r.BodyType {
+	case bodyNone:
+		return nil
+	case bodyJSON:
+		return raw("json")
+	case bodyText:
+		return raw("text")
+	case bodyXML:
+		return raw("xml")
+	case bodyForm:
+		return &postmanBody{Mode: "urlencoded", URLEncoded: toPostmanKeyValues(r.Form, "")}
+	case bodyMultipart:
+		body := &postmanBody{Mode: "formdata"}
+		for _, kv := range r.Form {
+			field := postmanKeyValue{Key: kv.Key, Value: kv.Value, Type: "text", Disabled: kv.Disabled, Description: postmanDescription(kv.Description)}
+			if kv.Type == formFile {
+				field.Value, field.Type, field.Src = "", "file", kv.Value
+			}
+			body.FormData = append(body.FormData, field)
+		}
+		return body
+	case bodyBinary:
+		if r.BodyFile == "" {
+			return nil
+		}
+		return &postmanBody{Mode: "file", File: &postmanFile{Src: r.BodyFile}}
+	}
+
+	// Requests saved before body types existed
+	contentType, _ := r.Headers.header("Content-Type")
+	_, formErr := url.ParseQuery(r.Body)
+	switch {
+	case r.Body == "":
+		return nil
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded") && formErr == nil:
+		return &postmanBody{Mode: "urlencoded", URLEncoded: toPostmanKeyValues(parseQuery(r.Body), "")}
+	case json.Valid([]byte(r.Body)):
+		return raw("json")
+	}
+	return &postmanBody{Mode: "raw", Raw: r.Body}
+}
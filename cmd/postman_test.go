@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func importFixture(t *testing.T, name string, saved *SavedData) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importPostman(data, saved); err != nil {
+		t.Fatalf("importing %s: %v", name, err)
+	}
+}
+
+// requestsByName returns the imported requests without their generated ids.
+func requestsByName(saved SavedData) map[string]Request {
+	requests := map[string]Request{}
+	for _, r := range saved.Requests {
+		r.Id = ""
+		requests[r.Name] = r
+	}
+	return requests
+}
+
+func TestImportPostmanCollection(t *testing.T) {
+	var saved SavedData
+	importFixture(t, "shop.postman_collection.json", &saved)
+	requests := requestsByName(saved)
+
+	if len(requests) != 8 {
+		t.Fatalf("imported %d requests, want 8", len(requests))
+	}
+
+	list := requests["List products"]
+	if list.Folder != "Shop/Products" || list.URL != "{{baseUrl}}/products" {
+		t.Errorf("List products folder %q, URL %q", list.Folder, list.URL)
+	}
+	wantQuery := KeyValues{{Key: "page", Value: "1"}, {Key: "sort", Value: "name"}, {Key: "tag", Value: "sale", Disabled: true}}
+	if !reflect.DeepEqual(list.QueryParams, wantQuery) {
+		t.Errorf("query = %+v", list.QueryParams)
+	}
+	wantHeaders := KeyValues{{Key: "Accept", Value: "application/json"}, {Key: "X-Debug", Value: "1", Disabled: true, Description: "server side tracing"}}
+	if !reflect.DeepEqual(list.Headers, wantHeaders) {
+		t.Errorf("headers = %+v", list.Headers)
+	}
+	if list.BodyType != bodyNone {
+		t.Errorf("body type = %q", list.BodyType)
+	}
+
+	if folder := requests["Add review"].Folder; folder != "Shop/Products/Reviews" {
+		t.Errorf("nested folder = %q", folder)
+	}
+
+	bodyTypes := map[string]string{
+		"Add review":     bodyJSON,
+		"Upload image":   bodyMultipart,
+		"Login":          bodyForm,
+		"Import catalog": bodyBinary,
+		"Feed":           bodyXML,
+		"Note":           bodyText,
+		"Health":         bodyNone,
+	}
+	for name, want := range bodyTypes {
+		if got := requests[name].BodyType; got != want {
+			t.Errorf("%s body type = %q, want %q", name, got, want)
+		}
+	}
+
+	wantForm := KeyValues{
+		{Key: "title", Value: "Front"},
+		{Key: "owner", Value: "@handle", Description: "a mention, not a file"},
+		{Key: "image", Value: "/tmp/front.png", Type: formFile},
+		{Key: "draft", Value: "true", Disabled: true},
+	}
+	if form := requests["Upload image"].Form; !reflect.DeepEqual(form, wantForm) {
+		t.Errorf("multipart form = %+v", form)
+	}
+	wantURLEncoded := KeyValues{{Key: "user", Value: "ada"}, {Key: "remember", Value: "yes", Disabled: true}}
+	if form := requests["Login"].Form; !reflect.DeepEqual(form, wantURLEncoded) {
+		t.Errorf("urlencoded form = %+v", form)
+	}
+	if file := requests["Import catalog"].BodyFile; file != "/tmp/catalog.csv" {
+		t.Errorf("binary file = %q", file)
+	}
+
+	auths := map[string]*Auth{
+		"List products":  {Type: authBearer, Token: "{{token}}"},
+		"Add review":     {Type: authBasic, Username: "ada", Password: "{{password}}"},
+		"Upload image":   {Type: authAPIKey, Key: "X-Api-Key", Value: "{{apiKey}}", In: "header"},
+		"Login":          {Type: authDigest, Username: "ada", Password: "secret"},
+		"Import catalog": {Type: authOAuth2, Grant: grantAuthorizationCode, TokenURL: "https://auth.example.com/token", AuthURL: "https://auth.example.com/authorize", ClientID: "shop-cli", Scope: "catalog:write"},
+		"Feed":           {Type: authAWSv4, AccessKey: "{{AWS_ACCESS_KEY_ID}}", SecretKey: "{{AWS_SECRET_ACCESS_KEY}}", Region: "eu-west-1", Service: "execute-api"},
+		"Note":           nil,
+	}
+	for name, want := range auths {
+		if got := requests[name].Auth; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s auth = %+v, want %+v", name, got, want)
+		}
+	}
+
+	variables, err := parseVariables(saved.Variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(variables, map[string]string{"baseUrl": "https://shop.example.com"}) {
+		t.Errorf("variables = %v, want the enabled collection variable", variables)
+	}
+}
+
+func TestPostmanRoundTrip(t *testing.T) {
+	var first SavedData
+	importFixture(t, "shop.postman_collection.json", &first)
+
+	exported, err := exportPostman(first, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var second SavedData
+	if _, err := importPostman(exported, &second); err != nil {
+		t.Fatalf("importing the export: %v\n%s", err, exported)
+	}
+
+	before, after := requestsByName(first), requestsByName(second)
+	if len(after) != len(before) {
+		t.Fatalf("round trip kept %d of %d requests", len(after), len(before))
+	}
+	for name, want := range before {
+		if got := after[name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s changed in the round trip:\n got %+v\nwant %+v", name, got, want)
+		}
+	}
+	if second.Variables != first.Variables {
+		t.Errorf("variables = %s, want %s", second.Variables, first.Variables)
+	}
+}
+
+func TestMultipartKeepsTextStartingWithAt(t *testing.T) {
+	r := Request{
+		Name:     "Mention",
+		Method:   "POST",
+		URL:      "https://example.com",
+		BodyType: bodyMultipart,
+		Form:     KeyValues{{Key: "owner", Value: "@handle"}, {Key: "note", Value: "<not a file"}},
+	}
+	exported, err := exportPostman(SavedData{Requests: []Request{r}}, "Mentions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved SavedData
+	if _, err := importPostman(exported, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Requests[0].Form; !reflect.DeepEqual(got, r.Form) {
+		t.Errorf("form = %+v, want %+v", got, r.Form)
+	}
+
+	content, contentType, err := requestBody(r, func(s string) string { return s })
+	if err != nil {
+		t.Fatalf("text fields were read as files: %v", err)
+	}
+	fields := multipartFields(t, content, contentType)
+	if fields["owner"] != "@handle" || fields["note"] != "<not a file" {
+		t.Errorf("fields sent = %v", fields)
+	}
+}
+
+// multipartFields reads the text fields of a multipart body.
+func multipartFields(t *testing.T, content []byte, contentType string) map[string]string {
+	t.Helper()
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		t.Fatalf("Content-Type = %q", contentType)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(content), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{}
+	for name, values := range form.Value {
+		fields[name] = values[0]
+	}
+	for name := range form.File {
+		fields[name] = "file " + form.File[name][0].Filename
+	}
+	return fields
+}
+
+func TestImportPostmanEnvironment(t *testing.T) {
+	var saved SavedData
+	importFixture(t, "staging.postman_environment.json", &saved)
+
+	env := saved.environment("staging")
+	if env == nil {
+		t.Fatal("environment staging wasn't imported")
+	}
+	variables, err := parseVariables(env.Variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"baseUrl": "https://staging.shop.example.com", "token": "staging-token"}
+	if !reflect.DeepEqual(variables, want) {
+		t.Errorf("variables = %v, want %v", variables, want)
+	}
+
+	// Importing again replaces the environment rather than adding another
+	importFixture(t, "staging.postman_environment.json", &saved)
+	if len(saved.Environments) != 1 {
+		t.Errorf("%d environments after importing twice", len(saved.Environments))
+	}
+}
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Indexes of the response tabs in Model.responseTabs.
+const (
+	bodyResponseTab = iota
+	headersResponseTab
+	cookiesResponseTab
+	infoResponseTab
+	testsResponseTab
+	consoleResponseTab
+)
+
+// responseContent renders the active response tab for the response viewport.
+func (m Model) responseContent() string {
+	switch m.activeResponseTab {
+	case headersResponseTab:
+		if m.result.statusCode == 0 {
+			return noResponse
+		}
+		return headersView(m.result.headers)
+	case cookiesResponseTab:
+		if m.result.statusCode == 0 {
+			return noResponse
+		}
+		return cookiesView(m.result.cookies)
+	case infoResponseTab:
+		if m.result.statusCode == 0 && m.timings == nil {
+			return noResponse
+		}
+		var info string
+		if m.result.statusCode != 0 {
+			info = infoView(m.result) + "\n"
+		}
+		if m.timings != nil {
+			info += keyStyle.Render("Timing:") + "\n" + m.timings.waterfall(m.responseViewport.Width)
+		}
+		return info
+	case testsResponseTab:
+		if m.result.statusCode == 0 {
+			return noResponse
+		}
+		if len(m.result.tests) == 0 && len(m.result.extracted) > 0 {
+			return extractView(m.result)
+		}
+		return testsView(m.result.tests) + extractView(m.result)
+	case consoleResponseTab:
+		if len(m.result.console) == 0 {
+			return "\n Nothing logged, scripts can write here with console.log"
+		}
+		return strings.Join(m.result.console, "\n")
+	default:
+		return m.response
+	}
+}
+
+const noResponse = "\n No response received yet"
+
+// headersView lists headers sorted by name, one value per line.
+func headersView(headers http.Header) string {
+	if len(headers) == 0 {
+		return "\n No headers"
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range headers[key] {
+			b.WriteString(keyStyle.Render(key+":") + " " + value + "\n")
+		}
+	}
+	return b.String()
+}
+
+// cookiesView describes every cookie set by the response with its attributes.
+func cookiesView(cookies []*http.Cookie) string {
+	if len(cookies) == 0 {
+		return "\n No cookies"
+	}
+
+	var b strings.Builder
+	for _, c := range cookies {
+		b.WriteString(keyStyle.Render(c.Name) + " = " + c.Value + "\n")
+		if c.Domain != "" {
+			b.WriteString("  Domain: " + c.Domain + "\n")
+		}
+		if c.Path != "" {
+			b.WriteString("  Path: " + c.Path + "\n")
+		}
+		if !c.Expires.IsZero() {
+			b.WriteString("  Expires: " + c.Expires.Format(time.RFC1123) + "\n")
+		}
+		if c.MaxAge != 0 {
+			b.WriteString(fmt.Sprintf("  Max-Age: %d\n", c.MaxAge))
+		}
+		if c.Secure {
+			b.WriteString("  Secure\n")
+		}
+		if c.HttpOnly {
+			b.WriteString("  HttpOnly\n")
+		}
+		switch c.SameSite {
+		case http.SameSiteLaxMode:
+			b.WriteString("  SameSite: Lax\n")
+		case http.SameSiteStrictMode:
+			b.WriteString("  SameSite: Strict\n")
+		case http.SameSiteNoneMode:
+			b.WriteString("  SameSite: None\n")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// infoView shows the response metadata that isn't a header or cookie.
+func infoView(res result) string {
+	var b strings.Builder
+
+	field := func(name, value string) {
+		b.WriteString(keyStyle.Render(name+":") + " " + value + "\n")
+	}
+
+	field("Status", res.status)
+	field("Protocol", res.proto)
+	field("URL", res.url)
+	if res.contentLength >= 0 {
+		field("Content-Length", fmt.Sprintf("%d bytes", res.contentLength))
+	} else {
+		field("Content-Length", "unknown")
+	}
+	field("Body Size", fmt.Sprintf("%d bytes", len(res.body)))
+	if len(res.unresolved) > 0 {
+		b.WriteString(failStyle.Render("Unresolved:") + " " + placeholderList(res.unresolved) + " (sent as is)\n")
+	}
+	if res.oauth != nil {
+		source := res.oauth.source + " " + res.oauth.grant + " token"
+		if res.oauth.retried {
+			source += ", fetched again after a 401"
+		}
+		field("OAuth 2.0", source)
+		field("Token", tokenSummary(res.oauth.token))
+	}
+	if res.proxy != "" {
+		field("Proxy", res.proxy)
+	}
+	if res.tls != nil {
+		field("TLS", tls.VersionName(res.tls.Version)+", "+tls.CipherSuiteName(res.tls.CipherSuite))
+	}
+	if res.insecure {
+		b.WriteString(failStyle.Render("Insecure:") + " the server's certificate was not verified\n")
+	}
+
+	if len(res.redirects) > 0 {
+		b.WriteString("\n" + keyStyle.Render("Redirects:") + "\n")
+		for i, hop := range res.redirects {
+			b.WriteString(fmt.Sprintf("  %d. %s\n", i+1, hop))
+		}
+	}
+
+	if res.tls != nil && len(res.tls.PeerCertificates) > 0 {
+		b.WriteString("\n" + keyStyle.Render("Certificates:") + "\n")
+		for i, cert := range res.tls.PeerCertificates {
+			b.WriteString(fmt.Sprintf("  %d. %s\n", i+1, certName(cert.Subject)))
+			b.WriteString(fmt.Sprintf("     issued by %s, valid until %s\n", certName(cert.Issuer), cert.NotAfter.Format("2006-01-02")))
+		}
+	}
+
+	if len(res.trailers) > 0 {
+		b.WriteString("\n" + keyStyle.Render("Trailers:") + "\n")
+		b.WriteString(headersView(res.trailers))
+	}
+
+	return b.String()
+}
+
+// proxyLabel describes the proxy a request to u goes through, with its
+// password hidden.
+func proxyLabel(s Settings, u *url.URL) string {
+	proxy, source, err := s.proxyFor(u)
+	switch {
+	case err != nil:
+		return err.Error()
+	case proxy == nil:
+		return "none"
+	}
+	return proxy.Redacted() + " (from " + source + ")"
+}
+
+// certName is the common name of a certificate subject or issuer, or the
+// whole name when it has none.
+func certName(name pkix.Name) string {
+	if name.CommonName != "" {
+		return name.CommonName
+	}
+	return name.String()
+}
+
+// testsView lists every assertion with its outcome.
+func testsView(results []assertionResult) string {
+	if len(results) == 0 {
+		return "\n No tests, add them in the Tests tab"
+	}
+
+	var b strings.Builder
+	b.WriteString(testsSummary(results) + "\n\n")
+	for _, r := range results {
+		if r.passed {
+			b.WriteString(keyStyle.Render("✓ PASS") + " " + r.name + "\n")
+			continue
+		}
+		b.WriteString(failStyle.Render("✗ FAIL") + " " + r.name + "\n")
+		b.WriteString("         " + r.message + "\n")
+	}
+	return b.String()
+}
+
+// extractView lists the variables extracted from the response.
+func extractView(res result) string {
+	if len(res.extracted) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n" + keyStyle.Render("Variables:") + "\n")
+	for _, r := range res.extracted {
+		if r.err != nil {
+			b.WriteString(failStyle.Render("✗ "+r.variable) + " " + r.err.Error() + "\n")
+			continue
+		}
+		b.WriteString(keyStyle.Render("✓ "+r.variable) + " = " + r.value + "\n")
+	}
+	if res.extractedTo != "" {
+		b.WriteString("saved in " + res.extractedTo + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of the run commands.
+const (
+	exitOK            = 0
+	exitError         = 1
+	exitUsage         = 2
+	exitStatusFailure = 3
+)
+
+// statusRange is an inclusive range of HTTP status codes.
+type statusRange struct {
+	from, to int
+}
+
+// parseStatusRanges reads a comma separated list of status codes such as
+// "404", "4xx" or "500-599". "none" or an empty list matches nothing.
+func parseStatusRanges(input string) ([]statusRange, error) {
+	var ranges []statusRange
+	for _, part := range strings.Split(input, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" || part == "none" {
+			continue
+		}
+
+		if len(part) == 3 && strings.HasSuffix(part, "xx") {
+			class, err := strconv.Atoi(part[:1])
+			if err != nil || class < 1 || class > 5 {
+				return nil, fmt.Errorf("invalid status class %q", part)
+			}
+			ranges = append(ranges, statusRange{class * 100, class*100 + 99})
+			continue
+		}
+
+		if from, to, ok := strings.Cut(part, "-"); ok {
+			lo, err1 := strconv.Atoi(strings.TrimSpace(from))
+			hi, err2 := strconv.Atoi(strings.TrimSpace(to))
+			if err1 != nil || err2 != nil || lo > hi {
+				return nil, fmt.Errorf("invalid status range %q", part)
+			}
+			ranges = append(ranges, statusRange{lo, hi})
+			continue
+		}
+
+		code, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q", part)
+		}
+		ranges = append(ranges, statusRange{code, code})
+	}
+	return ranges, nil
+}
+
+func matchStatus(ranges []statusRange, code int) bool {
+	for _, r := range ranges {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// variableFlag collects repeated --var key=value flags.
+type variableFlag map[string]string
+
+func (v variableFlag) String() string {
+	return fmt.Sprint(map[string]string(v))
+}
+
+func (v variableFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	v[strings.TrimSpace(key)] = val
+	return nil
+}
+
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	envName := flags.String("env", "", "environment to resolve variables from (default: the active one)")
+	vars := variableFlag{}
+	flags.Var(vars, "var", "set a variable, overriding the environment (repeatable)")
+	failStatus := flags.String("fail-status", "4xx,5xx", `status codes that fail the run, e.g. "404,5xx" or "400-599"; "none" to never fail`)
+	bodyOnly := flags.Bool("body", false, "print only the response body")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "run needs the name or id of a saved request")
+		return exitUsage
+	}
+
+	failures, err := parseStatusRanges(*failStatus)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	saved := getSavedData()
+	request, err := findRequest(saved, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	variables, err := saved.variables(*envName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to load variables:", err)
+		return exitError
+	}
+	for key, value := range vars {
+		variables[key] = value
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	res := execute(ctx, request, *envName, variables)
+	for _, line := range res.console {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	if len(res.unresolved) > 0 && res.statusCode != 0 {
+		fmt.Fprintln(os.Stderr, "warning: unresolved "+placeholderList(res.unresolved))
+	}
+	if res.insecure && res.statusCode != 0 {
+		fmt.Fprintln(os.Stderr, "warning: the server's certificate was not verified")
+	}
+	if res.statusCode == 0 {
+		// No response arrived: the body describes what went wrong
+		if status := strings.TrimSpace(res.status); status != "" {
+			fmt.Fprintln(os.Stderr, status)
+		}
+		fmt.Fprintln(os.Stderr, strings.TrimSpace(res.body))
+		return exitError
+	}
+
+	if !*bodyOnly {
+		fmt.Println(res.proto, res.status)
+		fmt.Print(formatHeaders(res.headers))
+		fmt.Println()
+	}
+	fmt.Println(res.body)
+
+	if len(res.tests) > 0 {
+		for _, t := range res.tests {
+			if t.passed {
+				fmt.Fprintf(os.Stderr, "✓ %s\n", t.name)
+			} else {
+				fmt.Fprintf(os.Stderr, "✗ %s: %s\n", t.name, t.message)
+			}
+		}
+		fmt.Fprintln(os.Stderr, testsSummary(res.tests))
+	}
+
+	if len(res.extracted) > 0 {
+		fmt.Fprintln(os.Stderr, extractSummary(res))
+	}
+
+	if passed, reason := judge(request, res, failures); !passed {
+		fmt.Fprintf(os.Stderr, "%s failed: %s\n", request.Name, reason)
+		return exitStatusFailure
+	}
+	return exitOK
+}
+
+// runOptionFlags adds the flags that set runOptions, shared by
+// run-collection and the options of the dashboard's runner. The returned
+// func reads them once they are parsed.
+func runOptionFlags(flags *flag.FlagSet) func() (runOptions, error) {
+	failStatus := flags.String("fail-status", "4xx,5xx", `status codes that fail a request, e.g. "404,5xx" or "400-599"; "none" to never fail`)
+	bail := flags.Bool("bail", false, "stop at the first failing request")
+	iterations := flags.Int("iterations", 1, "number of times to run the collection")
+	delay := flags.Duration("delay", 0, "pause between requests, e.g. 500ms")
+	return func() (runOptions, error) {
+		if *iterations < 1 || *delay < 0 {
+			return runOptions{}, fmt.Errorf("--iterations must be at least 1 and --delay can't be negative")
+		}
+		failures, err := parseStatusRanges(*failStatus)
+		if err != nil {
+			return runOptions{}, err
+		}
+		return runOptions{iterations: *iterations, delay: *delay, bail: *bail, failures: failures}, nil
+	}
+}
+
+// parseRunOptions reads the options typed into the runner, written as the
+// flags of run-collection such as "--iterations 3 --delay 500ms --bail".
+func parseRunOptions(input string) (runOptions, error) {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	options := runOptionFlags(flags)
+	if err := flags.Parse(strings.Fields(input)); err != nil {
+		return runOptions{}, err
+	}
+	if flags.NArg() > 0 {
+		return runOptions{}, fmt.Errorf("unexpected %q, options are --iterations, --delay, --bail and --fail-status", flags.Arg(0))
+	}
+	return options()
+}
+
+func runCollectionCommand(args []string) int {
+	flags := flag.NewFlagSet("run-collection", flag.ContinueOnError)
+	envName := flags.String("env", "", "environment to resolve variables from (default: the active one)")
+	vars := variableFlag{}
+	flags.Var(vars, "var", "set a variable, overriding the environment (repeatable)")
+	options := runOptionFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "run-collection takes at most one folder")
+		return exitUsage
+	}
+	opts, err := options()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	opts.environment = *envName
+
+	saved := getSavedData()
+	requests := collectionRequests(saved, flags.Arg(0))
+	if len(requests) == 0 {
+		fmt.Fprintf(os.Stderr, "no saved requests in %q\n", flags.Arg(0))
+		return exitError
+	}
+	variables, err := saved.variables(*envName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to load variables:", err)
+		return exitError
+	}
+	for key, value := range vars {
+		variables[key] = value
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	outcomes := runCollection(ctx, requests, variables, opts, func(o runOutcome) {
+		mark := "✓"
+		if !o.passed {
+			mark = "✗"
+		}
+		fmt.Printf("%s %s %s  %s  %s\n", mark, strings.ToUpper(o.request.Method), o.request.Name, outcomeStatus(o), formatDuration(o.duration))
+		for _, line := range o.result.console {
+			fmt.Println("  " + line)
+		}
+		if len(o.result.unresolved) > 0 && o.result.statusCode != 0 {
+			fmt.Println("  warning: unresolved " + placeholderList(o.result.unresolved))
+		}
+		if o.result.insecure && o.result.statusCode != 0 {
+			fmt.Println("  warning: the server's certificate was not verified")
+		}
+		if len(o.result.extracted) > 0 {
+			fmt.Println("  " + extractSummary(o.result))
+		}
+	})
+
+	fmt.Println()
+	fmt.Println(summaryTable(outcomes))
+
+	code := exitOK
+	for _, o := range outcomes {
+		if o.passed {
+			continue
+		}
+		if o.result.statusCode == 0 {
+			return exitError
+		}
+		code = exitStatusFailure
+	}
+	return code
+}
+
+// formatHeaders renders headers as sorted "Key: value" lines.
+func formatHeaders(headers map[string][]string) string {
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range headers[key] {
+			fmt.Fprintf(&b, "%s: %s\n", key, value)
+		}
+	}
+	return b.String()
+}
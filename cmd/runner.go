@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// runOptions control how a collection of requests is run.
+type runOptions struct {
+	// environment receives extracted variables, "" meaning the active one
+	environment string
+	iterations  int
+	delay       time.Duration
+	bail        bool
+	failures    []statusRange
+}
+
+// runOutcome is the result of one request within a collection run.
+type runOutcome struct {
+	iteration int
+	request   Request
+	result    result
+	duration  time.Duration
+	passed    bool
+	reason    string
+}
+
+// collectionRequests returns the saved requests in folder and its sub
+// folders, in the order they were saved. An empty folder selects everything.
+func collectionRequests(saved SavedData, folder string) []Request {
+	folder = strings.Trim(folder, "/")
+	var requests []Request
+	for _, r := range saved.Requests {
+		if folder == "" || r.Folder == folder || strings.HasPrefix(r.Folder, folder+"/") {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// runStep sends a single request of a collection and decides whether it
+// passed.
+func runStep(ctx context.Context, r Request, variables map[string]string, opts runOptions, iteration int) runOutcome {
+	start := time.Now()
+	res := execute(ctx, r, opts.environment, variables)
+	outcome := runOutcome{
+		iteration: iteration,
+		request:   r,
+		result:    res,
+		duration:  time.Since(start),
+	}
+	outcome.passed, outcome.reason = judge(r, res, opts.failures)
+	return outcome
+}
+
+// judge decides whether a response passes: it must have arrived, its tests
+// must pass and its status must not be one of failures. Requests with a
+// status test are judged by that test alone.
+func judge(r Request, res result, failures []statusRange) (bool, string) {
+	if res.statusCode == 0 {
+		return false, firstLine(res.body)
+	}
+	assertions, _ := parseAssertions(r.Tests)
+	if !hasStatusAssertion(assertions) && matchStatus(failures, res.statusCode) {
+		return false, "status " + res.status
+	}
+	if failure := firstFailure(res.tests); failure != "" {
+		return false, failure
+	}
+	return true, ""
+}
+
+// runCollection sends requests in order for every iteration, calling report
+// after each one. It stops early when ctx is cancelled or, with bail set,
+// after the first failure.
+func runCollection(ctx context.Context, requests []Request, variables map[string]string, opts runOptions, report func(runOutcome)) []runOutcome {
+	var outcomes []runOutcome
+	for iteration := 1; iteration <= max(opts.iterations, 1); iteration++ {
+		for _, r := range requests {
+			if len(outcomes) > 0 && opts.delay > 0 {
+				select {
+				case <-ctx.Done():
+					return outcomes
+				case <-time.After(opts.delay):
+				}
+			}
+			if ctx.Err() != nil {
+				return outcomes
+			}
+
+			outcome := runStep(ctx, r, variables, opts, iteration)
+			outcomes = append(outcomes, outcome)
+			if report != nil {
+				report(outcome)
+			}
+			if opts.bail && !outcome.passed {
+				return outcomes
+			}
+		}
+	}
+	return outcomes
+}
+
+// runSummary counts the passed and failed requests and their total duration.
+func runSummary(outcomes []runOutcome) string {
+	passed := 0
+	var total time.Duration
+	for _, o := range outcomes {
+		if o.passed {
+			passed++
+		}
+		total += o.duration
+	}
+	return fmt.Sprintf("%d passed, %d failed, %d requests in %s", passed, len(outcomes)-passed, len(outcomes), formatDuration(total))
+}
+
+// summaryTable renders the outcomes of a run as a plain text table.
+func summaryTable(outcomes []runOutcome) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tITERATION\tNAME\tMETHOD\tSTATUS\tDURATION\tRESULT")
+	for i, o := range outcomes {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\n", i+1, o.iteration, o.request.Name, strings.ToUpper(o.request.Method), outcomeStatus(o), formatDuration(o.duration), outcomeResult(o))
+	}
+	w.Flush()
+	return b.String() + "\n" + runSummary(outcomes)
+}
+
+func outcomeStatus(o runOutcome) string {
+	if o.result.statusCode == 0 {
+		if status := strings.TrimSpace(o.result.status); status != "" {
+			return status
+		}
+		return "Error"
+	}
+	return o.result.status
+}
+
+func outcomeResult(o runOutcome) string {
+	if o.passed {
+		return "PASS"
+	}
+	return "FAIL " + o.reason
+}
+
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// runStepMsg carries the outcome of one request of a collection run.
+type runStepMsg struct {
+	run     int
+	outcome runOutcome
+}
+
+// defaultRunOptions are the options the runner starts with.
+const defaultRunOptions = "--iterations 1 --delay 0s --fail-status 4xx,5xx"
+
+// collectionRunner runs requests from the dashboard and shows their results
+// as they come in. It opens on its options, which are typed as the flags of
+// run-collection.
+type collectionRunner struct {
+	width       int
+	height      int
+	styles      *Styles
+	returnModel board
+	requests    []Request
+	opts        runOptions
+	outcomes    []runOutcome
+	table       table.Model
+	cancel      context.CancelFunc
+	ctx         context.Context
+	// variables belong to the current run, which extracted values are
+	// added to; each run has its own so a stopped one can't touch them
+	variables map[string]string
+	// run identifies the current run so steps of a stopped run are dropped
+	run        int
+	prompt     textinput.Model
+	showPrompt bool
+	message    string
+}
+
+func newCollectionRunner(b board, requests []Request) (collectionRunner, tea.Cmd) {
+	m := collectionRunner{
+		width:       b.width,
+		height:      b.height,
+		styles:      b.styles,
+		returnModel: b,
+		requests:    requests,
+		prompt:      textinput.New(),
+	}
+
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		BorderStyle(lipgloss.HiddenBorder()).
+		Background(lipgloss.Color("62")).
+		Foreground(lipgloss.Color("230")).
+		BorderBottom(false).
+		Bold(true)
+	m.table = table.New(table.WithFocused(true), table.WithStyles(s))
+	m.sizeTable()
+
+	m.prompt.Prompt = "Options: "
+	m.prompt.Placeholder = "--iterations 3 --delay 500ms --bail --fail-status 5xx"
+	m.prompt.Cursor.Blink = false
+	m.prompt.SetValue(defaultRunOptions)
+	m.showPrompt = true
+	m.prompt.Focus()
+	return m, nil
+}
+
+// start begins a new run of every request with the options typed, dropping
+// earlier results.
+func (m *collectionRunner) start() tea.Cmd {
+	opts, err := parseRunOptions(m.prompt.Value())
+	if err != nil {
+		m.message = err.Error()
+		return nil
+	}
+	// Variables are read again for each run, so values extracted by the
+	// last one are seen
+	variables, err := getSavedData().variables("")
+	if err != nil {
+		m.message = "Error parsing Env Variables: " + err.Error()
+		return nil
+	}
+
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.run++
+	m.opts = opts
+	m.variables = variables
+	m.outcomes = nil
+	m.message = ""
+	m.table.SetRows(nil)
+	return m.step()
+}
+
+// total is the number of requests the run sends unless it is stopped.
+func (m collectionRunner) total() int {
+	return len(m.requests) * max(m.opts.iterations, 1)
+}
+
+// step sends the next request, or finishes the run when none are left.
+func (m *collectionRunner) step() tea.Cmd {
+	if len(m.outcomes) >= m.total() {
+		m.finish("")
+		return nil
+	}
+
+	ctx, run, variables, opts := m.ctx, m.run, m.variables, m.opts
+	next := len(m.outcomes)
+	r := m.requests[next%len(m.requests)]
+	iteration := next/len(m.requests) + 1
+	return func() tea.Msg {
+		if next > 0 && opts.delay > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(opts.delay):
+			}
+		}
+		return runStepMsg{run: run, outcome: runStep(ctx, r, variables, opts, iteration)}
+	}
+}
+
+// finish ends the current run, leaving message in the footer.
+func (m *collectionRunner) finish(message string) {
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+	m.message = message
+}
+
+func (m *collectionRunner) sizeTable() {
+	name := max((m.width-64)/2, 10)
+	m.table.SetColumns([]table.Column{
+		{Title: "#", Width: 3},
+		{Title: "Iter", Width: 4},
+		{Title: "Name", Width: name},
+		{Title: "Method", Width: 7},
+		{Title: "Status", Width: 16},
+		{Title: "Duration", Width: 9},
+		{Title: "Result", Width: max(m.width-name-64, 10)},
+	})
+	m.table.SetWidth(m.width - 2)
+	m.table.SetHeight(m.height - 6)
+}
+
+func (m collectionRunner) Init() tea.Cmd {
+	return nil
+}
+
+func (m collectionRunner) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case runStepMsg:
+		if msg.run != m.run || m.cancel == nil {
+			return m, nil
+		}
+		o := msg.outcome
+		m.outcomes = append(m.outcomes, o)
+		m.table.SetRows(append(m.table.Rows(), table.Row{
+			fmt.Sprint(len(m.outcomes)),
+			fmt.Sprint(o.iteration),
+			o.request.Name,
+			strings.ToUpper(o.request.Method),
+			outcomeStatus(o),
+			formatDuration(o.duration),
+			outcomeResult(o),
+		}))
+		m.table.GotoBottom()
+		if m.opts.bail && !o.passed {
+			m.finish("Stopped at the first failure")
+			return m, nil
+		}
+		cmd := m.step()
+		return m, cmd
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+
+		if m.showPrompt {
+			switch msg.String() {
+			case "esc":
+				m.showPrompt = false
+				m.prompt.Blur()
+				if m.run == 0 {
+					// Nothing was run, so back to the dashboard
+					m.returnModel.height = m.height
+					m.returnModel.width = m.width
+					return m.returnModel, nil
+				}
+				return m, nil
+			case "enter":
+				cmd := m.start()
+				if m.cancel != nil {
+					m.showPrompt = false
+					m.prompt.Blur()
+				}
+				return m, cmd
+			}
+			var cmd tea.Cmd
+			m.prompt, cmd = m.prompt.Update(msg)
+			return m, cmd
+		}
+
+		switch msg.String() {
+		case "esc":
+			if m.cancel != nil {
+				m.finish("Run stopped")
+				return m, nil
+			}
+			m.returnModel.height = m.height
+			m.returnModel.width = m.width
+			return m.returnModel, nil
+		case "r":
+			if m.cancel == nil {
+				cmd := m.start()
+				return m, cmd
+			}
+			return m, nil
+		case "o":
+			if m.cancel == nil {
+				m.showPrompt = true
+				m.message = ""
+				m.prompt.Focus()
+			}
+			return m, nil
+		}
+
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.sizeTable()
+	}
+
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+func (m collectionRunner) View() string {
+	title := fmt.Sprintf("Running %d requests", len(m.requests))
+	if m.opts.iterations > 1 {
+		title += fmt.Sprintf(" %d times", m.opts.iterations)
+	}
+	header := m.appBoundaryView(title)
+
+	summary := runSummary(m.outcomes)
+	if m.cancel != nil {
+		summary = fmt.Sprintf("Running %d of %d... %s", len(m.outcomes)+1, m.total(), summary)
+	}
+	footer := m.appBoundaryMessage(summary + " · r to run again, o for options, <ESC> to stop/go back")
+	if m.message != "" {
+		footer = m.appBoundaryMessage(m.message + " · " + summary)
+	}
+	if m.showPrompt {
+		footer = m.prompt.View()
+		if m.message != "" {
+			footer += "  " + failStyle.Render(m.message)
+		}
+	}
+
+	body := borderStyle.Width(m.width - 2).Height(m.height - 4).Render(m.table.View())
+	return m.styles.Base.Render(header + "\n" + body + "\n" + footer)
+}
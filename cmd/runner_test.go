@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseRunOptions(t *testing.T) {
+	opts, err := parseRunOptions(defaultRunOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.iterations != 1 || opts.delay != 0 || opts.bail || !matchStatus(opts.failures, 404) {
+		t.Errorf("default options = %+v", opts)
+	}
+
+	opts, err = parseRunOptions("--iterations 3 --delay 250ms --bail --fail-status 5xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.iterations != 3 || opts.delay != 250*time.Millisecond || !opts.bail || matchStatus(opts.failures, 404) || !matchStatus(opts.failures, 503) {
+		t.Errorf("options = %+v", opts)
+	}
+
+	for _, input := range []string{"--iterations 0", "--delay -1s", "--fail-status 9xx", "--unknown", "folder"} {
+		if _, err := parseRunOptions(input); err == nil {
+			t.Errorf("parseRunOptions(%q) succeeded", input)
+		}
+	}
+}
+
+// runUntilDone feeds the runner the messages of its commands until the run
+// stops sending requests.
+func runUntilDone(t *testing.T, m collectionRunner, cmd tea.Cmd) collectionRunner {
+	t.Helper()
+	for cmd != nil {
+		model, next := m.Update(cmd())
+		m, cmd = model.(collectionRunner), next
+	}
+	return m
+}
+
+func startRun(t *testing.T, requests []Request, options string) (collectionRunner, tea.Cmd) {
+	t.Helper()
+	m, _ := newCollectionRunner(board{width: 100, height: 30}, requests)
+	m.prompt.SetValue(options)
+	model, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(collectionRunner)
+	if m.showPrompt || cmd == nil {
+		t.Fatalf("run didn't start: %s", m.message)
+	}
+	return m, cmd
+}
+
+func statusServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte(`{"id":"` + r.URL.Path + `"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCollectionRunnerIterations(t *testing.T) {
+	useTempData(t)
+	server := statusServer(t)
+	requests := []Request{{Name: "a", Method: "GET", URL: server.URL + "/a"}, {Name: "b", Method: "GET", URL: server.URL + "/b"}}
+
+	m, cmd := startRun(t, requests, "--iterations 3 --delay 1ms")
+	m = runUntilDone(t, m, cmd)
+	if len(m.outcomes) != 6 || m.cancel != nil {
+		t.Fatalf("%d outcomes, running %v", len(m.outcomes), m.cancel != nil)
+	}
+	for i, o := range m.outcomes {
+		if o.iteration != i/2+1 || o.request.Name != requests[i%2].Name || !o.passed {
+			t.Errorf("outcome %d = iteration %d, %s, passed %v", i, o.iteration, o.request.Name, o.passed)
+		}
+	}
+}
+
+func TestCollectionRunnerBails(t *testing.T) {
+	useTempData(t)
+	server := statusServer(t)
+	requests := []Request{
+		{Name: "ok", Method: "GET", URL: server.URL + "/ok"},
+		{Name: "fail", Method: "GET", URL: server.URL + "/fail"},
+		{Name: "after", Method: "GET", URL: server.URL + "/after"},
+	}
+
+	m, cmd := startRun(t, requests, "--iterations 2 --bail")
+	m = runUntilDone(t, m, cmd)
+	if len(m.outcomes) != 2 || m.outcomes[1].passed {
+		t.Errorf("bailed after %d outcomes", len(m.outcomes))
+	}
+
+	// Without --bail every request is sent, and 5xx alone can pass
+	m, cmd = startRun(t, requests, "--fail-status 4xx")
+	m = runUntilDone(t, m, cmd)
+	if len(m.outcomes) != 3 || !m.outcomes[1].passed {
+		t.Errorf("%d outcomes, fail passed %v", len(m.outcomes), len(m.outcomes) > 1 && m.outcomes[1].passed)
+	}
+}
+
+func TestCollectionRunnerDropsStoppedRun(t *testing.T) {
+	useTempData(t)
+	server := statusServer(t)
+	requests := []Request{{Name: "extract", Method: "GET", URL: server.URL + "/a", Extract: `{"id": {"jsonPath": "$.id"}}`}}
+
+	m, stale := startRun(t, requests, defaultRunOptions)
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = model.(collectionRunner)
+	model, fresh := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = model.(collectionRunner)
+	if fresh == nil {
+		t.Fatal("the run didn't start again")
+	}
+
+	// Both runs extract into their variables at the same time
+	var wg sync.WaitGroup
+	msgs := make([]tea.Msg, 2)
+	for i, cmd := range []tea.Cmd{stale, fresh} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msgs[i] = cmd()
+		}()
+	}
+	wg.Wait()
+
+	model, _ = m.Update(msgs[0])
+	m = model.(collectionRunner)
+	if len(m.outcomes) != 0 {
+		t.Fatalf("the stopped run's result was kept")
+	}
+	model, _ = m.Update(msgs[1])
+	m = model.(collectionRunner)
+	if len(m.outcomes) != 1 || m.variables["id"] != "/a" {
+		t.Errorf("%d outcomes, variables %v", len(m.outcomes), m.variables)
+	}
+}
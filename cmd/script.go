@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const preScriptPlaceholder = `
+	write a JavaScript pre-request script
+	(Ctrl+t switches to the post-response script)
+
+env.set("timestamp", String(Date.now()))
+request.headers["X-Signature"] =
+	crypto.hmac("sha256", env.get("secret"), env.resolve(request.body))
+console.log("signing", request.url)`
+
+const postScriptPlaceholder = `
+	write a JavaScript post-response script
+	(Ctrl+t switches to the pre-request script)
+
+const data = response.json()
+env.set("userId", String(data.id))
+test("has an id", () => {
+	if (!data.id) throw new Error("missing id")
+})`
+
+// scriptTimeout stops scripts that run away, such as endless loops.
+var scriptTimeout = 5 * time.Second
+
+// scriptRun is shared by the scripts of one send. It holds the variables the
+// scripts read, the ones they set and everything they log.
+type scriptRun struct {
+	variables map[string]string
+	set       map[string]string
+	console   []string
+}
+
+func newScriptRun(variables map[string]string) *scriptRun {
+	return &scriptRun{variables: variables, set: map[string]string{}}
+}
+
+// runPre runs the pre-request script of r, which may change the request
+// before its placeholders are resolved.
+func (s *scriptRun) runPre(ctx context.Context, r Request) (Request, error) {
+	if strings.TrimSpace(r.PreScript) == "" {
+		return r, nil
+	}
+
+	request := map[string]any{
+		"name":    r.Name,
+		"method":  r.Method,
+		"url":     r.URL,
+		"headers": toAnyMap(r.Headers.toMap()),
+		"params":  toAnyMap(r.QueryParams.toMap()),
+		"body":    r.Body,
+	}
+
+	vm := s.newVM("pre")
+	vm.Set("request", request)
+	if err := s.run(ctx, vm, "pre", r.PreScript); err != nil {
+		return r, fmt.Errorf("pre-request script: %w", err)
+	}
+
+	method, ok := request["method"].(string)
+	if !ok {
+		message := fmt.Sprintf("request.method must be a string, not %s", scriptText(request["method"]))
+		s.console = append(s.console, "[pre] error: "+message)
+		return r, fmt.Errorf("pre-request script: %s", message)
+	}
+	r.Method = method
+	r.URL = scriptText(request["url"])
+	r.Body = scriptText(request["body"])
+	r.Headers = r.Headers.applyMap(toStringMap(request["headers"]))
+	r.QueryParams = r.QueryParams.applyMap(toStringMap(request["params"]))
+	return r, nil
+}
+
+// runPost runs the post-response script of r against the sent request and
+// its response. Tests registered with test() are added to res.tests, and a
+// failing script is reported as a failed test.
+func (s *scriptRun) runPost(ctx context.Context, r Request, req *http.Request, res *result) {
+	if strings.TrimSpace(r.PostScript) == "" {
+		return
+	}
+
+	var body string
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			body = string(b)
+		}
+	}
+
+	var elapsed int64
+	if res.timings != nil {
+		elapsed = res.timings.Total.Milliseconds()
+	}
+
+	vm := s.newVM("post")
+	vm.Set("request", map[string]any{
+		"name":    r.Name,
+		"method":  req.Method,
+		"url":     req.URL.String(),
+		"headers": headerMap(req.Header),
+		"body":    body,
+	})
+	vm.Set("response", map[string]any{
+		"status":  res.status,
+		"code":    res.statusCode,
+		"headers": headerMap(res.headers),
+		"body":    res.body,
+		"time":    elapsed,
+		"json": func() (any, error) {
+			var v any
+			if err := json.Unmarshal([]byte(res.body), &v); err != nil {
+				return nil, fmt.Errorf("response body is not JSON")
+			}
+			return v, nil
+		},
+	})
+	vm.Set("test", func(name string, fn goja.Callable) {
+		t := assertionResult{name: name, passed: true}
+		if _, err := fn(goja.Undefined()); err != nil {
+			t.passed = false
+			t.message = scriptError(err)
+		}
+		res.tests = append(res.tests, t)
+	})
+
+	if err := s.run(ctx, vm, "post", r.PostScript); err != nil {
+		res.tests = append(res.tests, assertionResult{name: "post-response script", message: err.Error()})
+	}
+}
+
+// newVM creates an interpreter with the env, console and crypto helpers.
+func (s *scriptRun) newVM(phase string) *goja.Runtime {
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.UncapFieldNameMapper())
+
+	vm.Set("env", map[string]any{
+		"get": func(name string) goja.Value {
+			if value, ok := s.variables[name]; ok {
+				return vm.ToValue(value)
+			}
+			return goja.Undefined()
+		},
+		"set": func(name string, value goja.Value) {
+			s.variables[name] = value.String()
+			s.set[name] = value.String()
+		},
+		"resolve": func(text string) string {
+			return replacePlaceholders(text, s.variables)
+		},
+	})
+
+	logger := func(level string) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			parts := make([]string, len(call.Arguments))
+			for i, arg := range call.Arguments {
+				parts[i] = consoleText(arg)
+			}
+			line := "[" + phase + "] "
+			if level != "" {
+				line += level + ": "
+			}
+			s.console = append(s.console, line+strings.Join(parts, " "))
+			return goja.Undefined()
+		}
+	}
+	vm.Set("console", map[string]any{
+		"log":   logger(""),
+		"info":  logger(""),
+		"warn":  logger("warn"),
+		"error": logger("error"),
+	})
+
+	vm.Set("crypto", map[string]any{
+		"hash": func(algorithm, message string) (string, error) {
+			h, err := newHash(algorithm)
+			if err != nil {
+				return "", err
+			}
+			sum := h()
+			sum.Write([]byte(message))
+			return hex.EncodeToString(sum.Sum(nil)), nil
+		},
+		"hmac": func(algorithm, key, message string) (string, error) {
+			h, err := newHash(algorithm)
+			if err != nil {
+				return "", err
+			}
+			mac := hmac.New(h, []byte(key))
+			mac.Write([]byte(message))
+			return hex.EncodeToString(mac.Sum(nil)), nil
+		},
+	})
+	vm.Set("btoa", func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	})
+	vm.Set("atob", func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	})
+
+	return vm
+}
+
+// run executes a script, stopping it when ctx is done or it runs too long.
+func (s *scriptRun) run(ctx context.Context, vm *goja.Runtime, phase, script string) error {
+	timer := time.AfterFunc(scriptTimeout, func() {
+		vm.Interrupt(fmt.Sprintf("script ran longer than %s", scriptTimeout))
+	})
+	defer timer.Stop()
+	stop := context.AfterFunc(ctx, func() {
+		vm.Interrupt("request cancelled")
+	})
+	defer stop()
+
+	if _, err := vm.RunScript(phase+"-script", script); err != nil {
+		message := scriptError(err)
+		s.console = append(s.console, "["+phase+"] error: "+message)
+		return errors.New(message)
+	}
+	return nil
+}
+
+// scriptError turns an interpreter error into a single readable line.
+func scriptError(err error) string {
+	switch e := err.(type) {
+	case *goja.Exception:
+		// Compile errors repeat their type in the message
+		return strings.Replace(e.Value().String(), "SyntaxError: SyntaxError: ", "SyntaxError: ", 1)
+	case *goja.InterruptedError:
+		return fmt.Sprint(e.Value())
+	}
+	return err.Error()
+}
+
+func newHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(strings.ReplaceAll(algorithm, "-", "")) {
+	case "md5":
+		return md5.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unknown hash %q, use md5, sha1, sha256 or sha512", algorithm)
+}
+
+// consoleText formats a logged value, writing objects as JSON.
+func consoleText(v goja.Value) string {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return fmt.Sprint(v)
+	}
+	switch v.Export().(type) {
+	case map[string]any, []any:
+		if b, err := json.Marshal(v.Export()); err == nil {
+			return string(b)
+		}
+	}
+	return v.String()
+}
+
+func toAnyMap(m map[string]string) map[string]any {
+	out := make(map[string]any, len(m))
+	for key, value := range m {
+		out[key] = value
+	}
+	return out
+}
+
+// toStringMap reads back an object a script may have replaced or filled with
+// non-string values.
+func toStringMap(v any) map[string]string {
+	out := map[string]string{}
+	if m, ok := v.(map[string]any); ok {
+		for key, value := range m {
+			if value == nil {
+				continue
+			}
+			out[key] = scriptText(value)
+		}
+	}
+	return out
+}
+
+// scriptText reads back a value a script set: null and undefined are
+// empty, and objects and arrays are written as JSON.
+func scriptText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]any, []any:
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+func headerMap(h http.Header) map[string]any {
+	out := make(map[string]any, len(h))
+	for key, values := range h {
+		out[key] = strings.Join(values, ", ")
+	}
+	return out
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScriptsSetVariables(t *testing.T) {
+	useTempData(t)
+	server, _ := recordingServer(t)
+
+	r := Request{
+		Method:     "GET",
+		URL:        server.URL + "/{{path}}",
+		PreScript:  `env.set("path", "items"); env.set("count", 2)`,
+		PostScript: `env.set("seen", env.get("path") + ":" + env.get("count")); env.set("missing", String(env.get("nope")))`,
+	}
+	variables := map[string]string{}
+	res := execute(context.Background(), r, "", variables)
+	if res.statusCode != http.StatusOK {
+		t.Fatalf("status = %q, body %q", res.status, res.body)
+	}
+	if !strings.HasSuffix(res.url, "/items") {
+		t.Errorf("sent to %s, not the path the script set", res.url)
+	}
+
+	// The values are saved for later requests
+	saved, err := getSavedData().variables("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"path": "items", "count": "2", "seen": "items:2", "missing": "undefined"}
+	for key, value := range want {
+		if saved[key] != value {
+			t.Errorf("saved %s = %q, want %q", key, saved[key], value)
+		}
+	}
+}
+
+func TestPreScriptEditsRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		check  func(t *testing.T, r Request)
+	}{
+		{"headers", `request.headers["X-Added"] = "1"; request.headers["Accept"] = "text/plain"; delete request.headers["X-Removed"]`, func(t *testing.T, r Request) {
+			want := KeyValues{{Key: "Accept", Value: "text/plain"}, {Key: "X-Off", Value: "kept", Disabled: true}, {Key: "X-Added", Value: "1"}}
+			if len(r.Headers) != len(want) {
+				t.Fatalf("headers = %+v", r.Headers)
+			}
+			for i := range want {
+				if r.Headers[i] != want[i] {
+					t.Errorf("header %d = %+v, want %+v", i, r.Headers[i], want[i])
+				}
+			}
+		}},
+		{"params", `request.params.page = 2`, func(t *testing.T, r Request) {
+			if v, _ := r.QueryParams.header("page"); v != "2" {
+				t.Errorf("params = %+v", r.QueryParams)
+			}
+		}},
+		{"method and url", `request.method = "PUT"; request.url += "/1"`, func(t *testing.T, r Request) {
+			if r.Method != "PUT" || r.URL != "https://example.com/items/1" {
+				t.Errorf("method %q, url %q", r.Method, r.URL)
+			}
+		}},
+		{"body undefined", `request.body = undefined`, bodyIs("")},
+		{"body null", `request.body = null`, bodyIs("")},
+		{"body deleted", `delete request.body`, bodyIs("")},
+		{"body object", `request.body = {a: 1, b: [true, "x"]}`, bodyIs(`{"a":1,"b":[true,"x"]}`)},
+		{"body array", `request.body = [1, 2]`, bodyIs(`[1,2]`)},
+		{"body number", `request.body = 1.5`, bodyIs("1.5")},
+		{"body text", `request.body = JSON.stringify({signed: crypto.hash("sha256", "")})`, bodyIs(`{"signed":"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Request{
+				Method:    "GET",
+				URL:       "https://example.com/items",
+				Headers:   KeyValues{{Key: "Accept", Value: "*/*"}, {Key: "X-Removed", Value: "1"}, {Key: "X-Off", Value: "kept", Disabled: true}},
+				Body:      "original",
+				PreScript: tt.script,
+			}
+			r, err := newScriptRun(map[string]string{}).runPre(context.Background(), r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, r)
+		})
+	}
+}
+
+func bodyIs(want string) func(t *testing.T, r Request) {
+	return func(t *testing.T, r Request) {
+		t.Helper()
+		if r.Body != want {
+			t.Errorf("body = %q, want %q", r.Body, want)
+		}
+	}
+}
+
+func TestPreScriptRejectsNonStringMethod(t *testing.T) {
+	for _, script := range []string{`request.method = 1`, `request.method = null`, `delete request.method`, `request.method = {}`} {
+		scripts := newScriptRun(map[string]string{})
+		r := Request{Method: "GET", URL: "https://example.com", PreScript: script}
+		if _, err := scripts.runPre(context.Background(), r); err == nil || !strings.Contains(err.Error(), "request.method must be a string") {
+			t.Errorf("%s: err = %v", script, err)
+		}
+		if len(scripts.console) == 0 {
+			t.Errorf("%s: the error wasn't logged", script)
+		}
+	}
+}
+
+func TestPostScriptTests(t *testing.T) {
+	useTempData(t)
+	server, _ := recordingServer(t)
+
+	r := Request{
+		Method: "GET",
+		URL:    server.URL,
+		PostScript: `
+test("status is 200", () => { if (response.code !== 200) throw new Error("got " + response.code) })
+test("body is json", () => { response.json() })
+test("fails", () => { throw new Error("nope") })
+console.log("body", response.body)`,
+	}
+	res := execute(context.Background(), r, "", map[string]string{})
+	want := []assertionResult{
+		{name: "status is 200", passed: true},
+		{name: "body is json", message: "GoError: response body is not JSON"},
+		{name: "fails", message: "Error: nope"},
+	}
+	if len(res.tests) != len(want) {
+		t.Fatalf("tests = %+v", res.tests)
+	}
+	for i := range want {
+		if res.tests[i].name != want[i].name || res.tests[i].passed != want[i].passed || res.tests[i].message != want[i].message {
+			t.Errorf("test %d = %+v, want %+v", i, res.tests[i], want[i])
+		}
+	}
+	if len(res.console) != 1 || res.console[0] != "[post] body ok" {
+		t.Errorf("console = %q", res.console)
+	}
+
+	// A script that throws is a failed test of its own
+	r.PostScript = `throw new Error("broken")`
+	res = execute(context.Background(), r, "", map[string]string{})
+	if len(res.tests) != 1 || res.tests[0].passed || res.tests[0].message != "Error: broken" {
+		t.Errorf("tests = %+v", res.tests)
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	timeout := scriptTimeout
+	scriptTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { scriptTimeout = timeout })
+
+	start := time.Now()
+	r := Request{Method: "GET", URL: "https://example.com", PreScript: `while (true) {}`}
+	_, err := newScriptRun(map[string]string{}).runPre(context.Background(), r)
+	if err == nil || !strings.Contains(err.Error(), "script ran longer than 50ms") {
+		t.Errorf("err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the script ran for %s", elapsed)
+	}
+
+	// Cancelling the request stops the script too
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	scriptTimeout = time.Minute
+	if _, err := newScriptRun(map[string]string{}).runPre(ctx, r); err == nil || !strings.Contains(err.Error(), "request cancelled") {
+		t.Errorf("err after cancelling = %v", err)
+	}
+}
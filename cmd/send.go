@@ -2,237 +2,387 @@ package cmd
 
 import (
 	"bytes"
-	"encoding/json"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
 )
 
-func send(m Model) (string, string) {
-	variablesJSON := loadVariables()
-	method := strings.ToUpper(strings.TrimSpace(m.methodField.Value()))
-	URL := strings.TrimSpace(m.urlField.Value())
-	headersJSON := strings.TrimSpace(m.tabContent[2].Value())
-	paramsJSON := strings.TrimSpace(m.tabContent[1].Value())
-
-	// Parse variables into a map
-	var variables map[string]string
-	if variablesJSON == "" { // "" is not valid string to unmarshal. occurs when user doesn't init any env vars.
-		variables = make(map[string]string)
-	} else {
-		er := json.Unmarshal([]byte(variablesJSON), &variables)
-		if er != nil {
-			return "\n Error parsing Env Variables", "Incorrect Env Variables"
-		}
-	}
+// requestError is returned while building a request. It carries the text shown
+// in the response panel along with the short status label.
+type requestError struct {
+	message string
+	status  string
+}
 
-	URL = replacePlaceholders(URL, variables)
-	headersJSON = replacePlaceholders(headersJSON, variables)
-	paramsJSON = replacePlaceholders(paramsJSON, variables)
+func (e requestError) Error() string {
+	return e.message
+}
+
+// result is the outcome of sending a request. When the request fails before a
+// response arrives only body and status are set, describing the failure.
+type result struct {
+	body          string
+	status        string
+	statusCode    int
+	proto         string
+	url           string
+	headers       http.Header
+	trailers      http.Header
+	cookies       []*http.Cookie
+	contentLength int64
+	redirects     []string
+	timings       *Timings
+	// tests holds the outcome of the request's assertions
+	tests []assertionResult
+	// extracted holds the variables read from the response, which were
+	// stored in the environment named by extractedTo
+	extracted   []extractResult
+	extractedTo string
+	// console holds the lines logged by the request's scripts
+	console []string
+	// unresolved names the placeholders that were sent without a variable
+	unresolved []string
+	// oauth describes the OAuth 2.0 token that was sent, if any
+	oauth *oauthUse
+	// tls is the connection the response came over, nil for plain HTTP
+	tls *tls.ConnectionState
+	// insecure is set when the server's certificate wasn't verified
+	insecure bool
+	// proxy describes the proxy the request went through
+	proxy string
+}
 
-	// Parse JSON into a map
-	var headers map[string]string
-	err := json.Unmarshal([]byte(headersJSON), &headers)
+// send executes the request in the editor. It stops early when ctx is
+// cancelled or the configured timeout expires.
+func send(ctx context.Context, m Model) result {
+	// Globals overlaid with the active environment
+	variables, err := getSavedData().variables("")
 	if err != nil {
-		return " \n Error parsing Headers \n\n Correct the Headers format", " Incorrect Headers "
+		return result{body: "\n Error parsing Env Variables\n\n " + err.Error(), status: "Incorrect Env Variables"}
 	}
 
-	if paramsJSON != "" {
-		var params map[string]string
-		Err := json.Unmarshal([]byte(paramsJSON), &params)
-		if Err != nil {
-			return " \n Error parsing Params \n\n Correct the Params format", " Incorrect Params "
-		}
+	return execute(ctx, m.request(), "", variables)
+}
 
-		// Create a URL object
-		parsedURL, err := url.Parse(URL)
-		if err != nil {
-			return " \n Error parsing Params \n\n Correct the Params format", " Incorrect Params "
-		}
+// execute resolves, sends and records a request. It is shared by the editor
+// and the command line so both behave the same. Variables extracted from a
+// successful response are added to variables and stored in the named
+// environment, "" meaning the active one.
+func execute(ctx context.Context, r Request, environment string, variables map[string]string) result {
+	global := loadSettings()
+	if err := global.validate(); err != nil {
+		return result{body: " \n Error parsing global Settings \n\n " + err.Error(), status: " Incorrect Settings "}
+	}
+	local, err := parseSettings(r.Settings)
+	if err != nil {
+		return result{body: " \n Error parsing Settings \n\n " + err.Error(), status: " Incorrect Settings "}
+	}
+	settings := global.merge(local)
 
-		// Add query parameters to the URL
-		q := parsedURL.Query()
-		for key, value := range params {
-			q.Set(key, value)
-		}
-		parsedURL.RawQuery = q.Encode()
+	assertions, err := parseAssertions(r.Tests)
+	if err != nil {
+		return result{body: " \n Error parsing Tests \n\n " + err.Error(), status: " Incorrect Tests "}
+	}
+	extractions, err := parseExtractions(r.Extract)
+	if err != nil {
+		return result{body: " \n Error parsing Extract \n\n " + err.Error(), status: " Incorrect Extract "}
+	}
 
-		URL = parsedURL.String()
+	if timeout, _ := parseDuration(settings.Timeout); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	switch method {
-	case "GET":
-		// Make the GET request
-		resp, err := http.Get(URL)
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
-		}
+	scripts := newScriptRun(variables)
+	r, err = scripts.runPre(ctx, r)
+	if err != nil {
+		return result{body: " \n Error running Script \n\n " + err.Error(), status: " Script Error ", console: scripts.console}
+	}
 
-		// Set headers
-		for key, value := range headers {
-			resp.Header.Set(key, value)
+	unresolved := unresolvedVariables(variables, requestTexts(r)...)
+	if len(unresolved) > 0 && settings.BlockUnresolved != nil && *settings.BlockUnresolved {
+		return result{
+			body:       " \n No value for " + placeholderList(unresolved) + " \n\n Set them in the environment, or turn off blockUnresolved in Settings",
+			status:     " Unresolved Variables ",
+			console:    scripts.console,
+			unresolved: unresolved,
 		}
+	}
 
-		defer resp.Body.Close()
+	settings = settings.resolved(variables)
+	client, err := clientFor(settings)
+	if err != nil {
+		return result{body: " \n Error loading TLS Settings \n\n " + err.Error(), status: " Incorrect Settings ", console: scripts.console}
+	}
+	r, oauth, err := authorizeOAuth2(ctx, client, r, variables, false)
+	if err != nil {
+		return result{body: " \n Error getting OAuth 2.0 token \n\n " + err.Error(), status: " OAuth2 Error ", console: scripts.console}
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return "Failed to read response body\n\n" + err.Error(), ""
+	req, err := buildRequest(ctx, r, variables)
+	if err != nil {
+		var reqErr requestError
+		if errors.As(err, &reqErr) {
+			return result{body: reqErr.message, status: reqErr.status, console: scripts.console}
 		}
+		return result{body: "Failed to make request\n\n" + err.Error(), console: scripts.console}
+	}
 
-		return string(body), resp.Status
-
-	case "POST":
-		content := replacePlaceholders(m.tabContent[0].Value(), variables)
-		payload := []byte(content)
-
-		client := &http.Client{}
-		req, err := http.NewRequest("POST", URL, bytes.NewBuffer(payload))
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
+	res := do(client, req)
+	if res.statusCode == http.StatusUnauthorized && oauth != nil && oauth.source == "cached" {
+		// The cached token may have been revoked, so a new one is fetched
+		// and the request sent once more
+		if retried, use, err := authorizeOAuth2(ctx, client, r, variables, true); err == nil {
+			if retry, err := buildRequest(ctx, retried, variables); err == nil {
+				r, req, oauth = retried, retry, use
+				oauth.retried = true
+				res = do(client, req)
+			}
 		}
-
-		// Set headers
-		for key, value := range headers {
-			req.Header.Set(key, value)
+	}
+	res.unresolved = unresolved
+	res.oauth = oauth
+	res.insecure = settings.insecure()
+	res.proxy = proxyLabel(settings, req.URL)
+	if res.statusCode != 0 {
+		res.tests = checkAssertions(assertions, res)
+		scripts.runPost(ctx, r, req, &res)
+	}
+	res.console = scripts.console
+
+	// Variables set by scripts and extracted from the response are saved
+	// together once the request is done.
+	values := scripts.set
+	if res.statusCode >= 200 && res.statusCode < 400 && len(extractions) > 0 {
+		res.extracted = extractVariables(extractions, res)
+		for key, value := range extractedValues(res.extracted) {
+			variables[key] = value
+			values[key] = value
 		}
-
-		resp, err := client.Do(req)
+	}
+	if len(values) > 0 {
+		label, err := storeVariables(environment, values)
 		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
+			res.console = append(res.console, "variables not saved: "+err.Error())
+			for i := range res.extracted {
+				if res.extracted[i].err == nil {
+					res.extracted[i].err = fmt.Errorf("not saved: %w", err)
+				}
+			}
 		}
-		defer resp.Body.Close()
+		res.extractedTo = label
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return "Failed to read response body\n\n" + err.Error(), ""
-		}
-		return string(body), resp.Status
+	recordHistory(r, req, res, variables)
+	return res
+}
 
-	case "PUT":
-		content := replacePlaceholders(m.tabContent[0].Value(), variables)
-		payload := []byte(content)
+// do sends a built request and reads the whole response, timing each phase.
+func do(client *http.Client, req *http.Request) result {
+	start := time.Now()
+	t := newTracer()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.trace()))
 
-		client := &http.Client{}
-		req, err := http.NewRequest("PUT", URL, bytes.NewBuffer(payload))
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
-		}
+	resp, err := client.Do(req)
+	if err != nil {
+		return failure("Failed to make request", err, time.Since(start))
+	}
+	defer resp.Body.Close()
 
-		// Set headers
-		for key, value := range headers {
-			req.Header.Set(key, value)
-		}
+	body, err := readBody(resp)
+	if err != nil {
+		return failure("Failed to read response body", err, time.Since(start))
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
-		}
-		defer resp.Body.Close()
+	res := result{
+		body:          string(body),
+		status:        resp.Status,
+		statusCode:    resp.StatusCode,
+		proto:         resp.Proto,
+		url:           resp.Request.URL.String(),
+		headers:       resp.Header,
+		trailers:      resp.Trailer,
+		cookies:       resp.Cookies(),
+		contentLength: resp.ContentLength,
+		timings:       t.done(int64(len(body))),
+		tls:           resp.TLS,
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return "Failed to read response body\n\n" + err.Error(), ""
-		}
-		return string(body), resp.Status
+	// Each request made while following redirects keeps the response that
+	// caused it, so walk back through them to recover the chain.
+	for prev := resp.Request.Response; prev != nil; prev = prev.Request.Response {
+		hop := fmt.Sprintf("%s %s -> %s", prev.Status, prev.Request.URL, prev.Header.Get("Location"))
+		res.redirects = append([]string{hop}, res.redirects...)
+	}
 
-	case "DELETE":
-		client := &http.Client{}
-		req, err := http.NewRequest("DELETE", URL, nil)
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
-		}
+	return res
+}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
-		}
-		defer resp.Body.Close()
+// failure describes a transport error for the response panel. Cancelled and
+// timed out requests are called out along with how long they ran.
+func failure(message string, err error, elapsed time.Duration) result {
+	elapsed = elapsed.Round(time.Millisecond)
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return result{body: fmt.Sprintf("Request cancelled after %s", elapsed), status: " Cancelled "}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return result{body: fmt.Sprintf("Request timed out after %s\n\n%s", elapsed, err), status: " Timed Out "}
+	}
 
-		// Set headers
-		for key, value := range headers {
-			resp.Header.Set(key, value)
-		}
+	// Certificates signed by a private CA, or for another name, can be
+	// allowed in Settings
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return result{body: message + "\n\n" + err.Error() + "\n\nSet caFile in Settings to trust a private CA", status: " TLS Error "}
+	case errors.As(err, &hostname):
+		return result{body: message + "\n\n" + err.Error() + "\n\nSet serverName in Settings when the certificate is issued for another name", status: " TLS Error "}
+	}
+	return result{body: message + "\n\n" + err.Error()}
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return "Failed to read response body\n\n" + err.Error(), ""
-		}
-		return string(body), resp.Status
+// buildRequest turns a saved or edited request into an *http.Request. Headers,
+// query params and the body are applied the same way regardless of method, so
+// custom verbs behave exactly like the standard ones.
+func buildRequest(ctx context.Context, r Request, variables map[string]string) (*http.Request, error) {
+	method := strings.ToUpper(strings.TrimSpace(r.Method))
+	URL := strings.TrimSpace(r.URL)
 
-	case "HEAD":
-		resp, err := http.Head(URL)
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
-		}
-		defer resp.Body.Close()
+	if method == "" || URL == "" {
+		return nil, requestError{"Request Method or Url is set incorrectly", " Incorrect Request "}
+	}
 
-		// Set headers
-		for key, value := range headers {
-			resp.Header.Set(key, value)
+	// Built-ins such as {{$uuid}} are evaluated here, once per send
+	var resolveErr error
+	resolve := func(text string) string {
+		resolved, err := resolvePlaceholders(text, variables)
+		if err != nil && resolveErr == nil {
+			resolveErr = err
 		}
+		return resolved
+	}
+	URL = resolve(URL)
+	headers := r.Headers.resolved(resolve)
+	params := r.QueryParams.resolved(resolve)
+	auth := r.Auth.resolved(resolve)
+	content, contentType, bodyErr := requestBody(r, resolve)
+	if resolveErr != nil {
+		return nil, requestError{" \n Error resolving placeholders \n\n " + resolveErr.Error(), " Incorrect Placeholder "}
+	}
+	if bodyErr != nil {
+		return nil, requestError{" \n Error reading Body \n\n " + bodyErr.Error(), " Incorrect Body "}
+	}
 
-		body, err := io.ReadAll(resp.Body)
+	if len(params) > 0 {
+		// Create a URL object
+		parsedURL, err := url.Parse(URL)
 		if err != nil {
-			return "Failed to read response body\n\n" + err.Error(), ""
+			return nil, requestError{" \n Error parsing Params \n\n " + err.Error(), " Incorrect Params "}
 		}
-		return string(body), resp.Status
-
-	case "PATCH":
-		content := replacePlaceholders(m.tabContent[0].Value(), variables)
-		payload := []byte(content)
 
-		client := &http.Client{}
-		req, err := http.NewRequest("PATCH", URL, bytes.NewBuffer(payload))
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
+		// Params follow the URL's own query string, in order, and a
+		// repeated key is sent once per row
+		if parsedURL.RawQuery != "" {
+			parsedURL.RawQuery += "&"
 		}
+		parsedURL.RawQuery += encodeQuery(params)
 
-		// Set headers
-		for key, value := range headers {
-			req.Header.Set(key, value)
-		}
+		URL = parsedURL.String()
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
-		}
-		defer resp.Body.Close()
+	var body io.Reader
+	if content != nil {
+		body = bytes.NewReader(content)
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return "Failed to read response body\n\n" + err.Error(), ""
+	req, err := http.NewRequestWithContext(ctx, method, URL, body)
+	if err != nil {
+		return nil, requestError{"Request Method or Url is set incorrectly\n\n" + err.Error(), " Incorrect Request "}
+	}
+
+	// Set headers, a repeated header is sent once per row
+	for _, kv := range headers {
+		if strings.EqualFold(kv.Key, "Host") {
+			req.Host = kv.Value
+			continue
 		}
+		req.Header.Add(kv.Key, kv.Value)
+	}
 
-		return string(body), resp.Status
+	req, err = applyAuth(req, auth)
+	if err != nil {
+		return nil, requestError{" \n Error applying Auth \n\n " + err.Error(), " Incorrect Auth "}
+	}
 
-	case "OPTIONS":
-		client := &http.Client{}
-		req, err := http.NewRequest("OPTIONS", URL, nil)
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
-		}
+	// A Content-Type typed in the Headers tab wins, except for multipart
+	// bodies whose boundary has to match
+	if contentType != "" && (req.Header.Get("Content-Type") == "" || r.BodyType == bodyMultipart) {
+		req.Header.Set("Content-Type", contentType)
+	}
 
-		// Set headers
-		for key, value := range headers {
-			req.Header.Set(key, value)
+	// Signing comes last, as it covers the headers and body as they are sent
+	if auth.Type == authAWSv4 && req.Header.Get("Authorization") == "" {
+		if err := signSigV4(req, auth); err != nil {
+			return nil, requestError{" \n Error signing the request \n\n " + err.Error(), " Incorrect Auth "}
 		}
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return "Failed to make request\n\n" + err.Error(), ""
-		}
-		defer resp.Body.Close()
+	return req, nil
+}
+
+// readBody reads the whole response body. The transport only decompresses
+// responses when it picked the Accept-Encoding itself, so encodings requested
+// through the Headers tab are decoded here.
+func readBody(resp *http.Response) ([]byte, error) {
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 
-		body, err := io.ReadAll(resp.Body)
+	var reader io.Reader
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
 		if err != nil {
-			return "Failed to read response body\n\n" + err.Error(), ""
+			return raw, nil
 		}
-
-		return string(body), resp.Status
-
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		// Most servers send zlib-wrapped deflate, but a few send raw streams.
+		if zr, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+			defer zr.Close()
+			reader = zr
+		} else {
+			reader = flate.NewReader(bytes.NewReader(raw))
+		}
+	case "br":
+		reader = brotli.NewReader(bytes.NewReader(raw))
 	default:
-		return "Request Method or Url is set incorrectly", " Incorrect Request "
+		return raw, nil
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return raw, nil
 	}
+	return decoded, nil
 }
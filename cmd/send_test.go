@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTempData points the data, history and token files at a temporary
+// folder for the length of the test.
+func useTempData(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	folder, data, history, tokens, count := appFolder, jsonfilePath, historyFilePath, tokenFilePath, historyCount
+	appFolder = dir
+	jsonfilePath = filepath.Join(dir, "gostman.json")
+	historyFilePath = filepath.Join(dir, "history.jsonl")
+	tokenFilePath = filepath.Join(dir, "oauth2_tokens.json")
+	historyCount = -1
+	t.Cleanup(func() {
+		appFolder, jsonfilePath, historyFilePath, tokenFilePath, historyCount = folder, data, history, tokens, count
+	})
+}
+
+// received is what the test server saw of a request.
+type received struct {
+	method string
+	header http.Header
+	body   string
+	query  string
+}
+
+func recordingServer(t *testing.T) (*httptest.Server, *received) {
+	t.Helper()
+	got := &received{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*got = received{method: r.Method, header: r.Header.Clone(), body: string(body), query: r.URL.RawQuery}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, got
+}
+
+func TestExecuteSendsHeadersAndBodyForEveryMethod(t *testing.T) {
+	useTempData(t)
+	server, got := recordingServer(t)
+
+	tests := []struct {
+		method string
+		body   string
+	}{
+		{"GET", ""},
+		{"GET", `{"filter":"all"}`},
+		{"HEAD", ""},
+		{"POST", `{"name":"gostman"}`},
+		{"PUT", `{"name":"gostman"}`},
+		{"PATCH", `{"name":"gostman"}`},
+		{"DELETE", `{"id":1}`},
+		{"OPTIONS", ""},
+		{"PROPFIND", `<?xml version="1.0"?><propfind xmlns="DAV:"><allprop/></propfind>`},
+		{"PURGE", ""},
+		{"purge", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.body, func(t *testing.T) {
+			r := Request{
+				Method: tt.method,
+				URL:    server.URL + "/items",
+				Headers: KeyValues{
+					{Key: "Authorization", Value: "Bearer secret"},
+					{Key: "X-Trace", Value: "one"},
+					{Key: "X-Trace", Value: "two"},
+					{Key: "X-Disabled", Value: "no", Disabled: true},
+				},
+				QueryParams: KeyValues{{Key: "page", Value: "2"}},
+				Body:        tt.body,
+			}
+			res := execute(context.Background(), r, "", map[string]string{})
+			if res.statusCode != http.StatusOK {
+				t.Fatalf("status = %q, body %q", res.status, res.body)
+			}
+
+			if want := strings.ToUpper(tt.method); got.method != want {
+				t.Errorf("method = %q, want %q", got.method, want)
+			}
+			if v := got.header.Get("Authorization"); v != "Bearer secret" {
+				t.Errorf("Authorization = %q", v)
+			}
+			if v := got.header.Values("X-Trace"); len(v) != 2 || v[0] != "one" || v[1] != "two" {
+				t.Errorf("X-Trace = %q, want both rows in order", v)
+			}
+			if _, ok := got.header["X-Disabled"]; ok {
+				t.Error("disabled header was sent")
+			}
+			if got.query != "page=2" {
+				t.Errorf("query = %q", got.query)
+			}
+			if got.body != tt.body {
+				t.Errorf("body = %q, want %q", got.body, tt.body)
+			}
+		})
+	}
+}
+
+func TestExecuteResolvesPlaceholders(t *testing.T) {
+	useTempData(t)
+	server, got := recordingServer(t)
+
+	r := Request{
+		Method:  "POST",
+		URL:     server.URL + "/{{path}}",
+		Headers: KeyValues{{Key: "X-Api-Key", Value: "{{key}}"}},
+		Body:    `{"user":"{{user}}"}`,
+	}
+	res := execute(context.Background(), r, "", map[string]string{"path": "users", "key": "k-123", "user": "ada"})
+	if res.statusCode != http.StatusOK {
+		t.Fatalf("status = %q, body %q", res.status, res.body)
+	}
+	if v := got.header.Get("X-Api-Key"); v != "k-123" {
+		t.Errorf("X-Api-Key = %q", v)
+	}
+	if got.body != `{"user":"ada"}` {
+		t.Errorf("body = %q", got.body)
+	}
+}
+
+func TestBuildRequestRejectsMissingMethodOrURL(t *testing.T) {
+	for _, r := range []Request{{Method: "", URL: "http://example.com"}, {Method: "GET", URL: " "}} {
+		if _, err := buildRequest(context.Background(), r, nil); err == nil {
+			t.Errorf("buildRequest(%+v) succeeded", r)
+		}
+	}
+}
+
+func TestExecuteSendsKeysWithoutValue(t *testing.T) {
+	useTempData(t)
+	server, got := recordingServer(t)
+
+	r := Request{Method: "GET", URL: server.URL + "?fixed", QueryParams: parseQuery("flag&{{name}}&empty=")}
+	res := execute(context.Background(), r, "", map[string]string{"name": "verbose"})
+	if res.statusCode != http.StatusOK {
+		t.Fatalf("status = %q, body %q", res.status, res.body)
+	}
+	if got.query != "fixed&flag&verbose&empty=" {
+		t.Errorf("query = %q", got.query)
+	}
+}
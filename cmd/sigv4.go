@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sigV4Now is the signing time, replaced when checking signatures.
+var sigV4Now = time.Now
+
+// awsEnvironment names the variables AWS Signature fields are read from,
+// as the AWS CLI does. The Auth tab fills new fields with the first as a
+// placeholder, so the active environment can set them, and a field that is
+// blank or whose placeholder isn't set falls back to the process environment.
+var awsEnvironment = map[string][]string{
+	"accessKey":    {"AWS_ACCESS_KEY_ID"},
+	"secretKey":    {"AWS_SECRET_ACCESS_KEY"},
+	"sessionToken": {"AWS_SESSION_TOKEN"},
+	"region":       {"AWS_REGION", "AWS_DEFAULT_REGION"},
+}
+
+// awsPlaceholders returns a with its blank AWS Signature fields set to the
+// placeholders of awsEnvironment. The session token is left out, as most
+// credentials aren't temporary.
+func awsPlaceholders(a Auth) Auth {
+	for _, f := range authFields[authAWSv4] {
+		if names := awsEnvironment[f.key]; len(names) > 0 && f.key != "sessionToken" && *f.value(&a) == "" {
+			*f.value(&a) = "{{" + names[0] + "}}"
+		}
+	}
+	return a
+}
+
+// awsFromEnvironment fills the fields of a resolved AWS Signature auth that
+// are blank or left as their placeholder from the process environment.
+func awsFromEnvironment(a Auth) Auth {
+	for _, f := range authFields[authAWSv4] {
+		value := f.value(&a)
+		*value = strings.TrimSpace(*value)
+		names := awsEnvironment[f.key]
+		if len(names) > 0 && *value == "{{"+names[0]+"}}" {
+			*value = ""
+		}
+		for _, name := range names {
+			if *value == "" {
+				*value = os.Getenv(name)
+			}
+		}
+	}
+	return a
+}
+
+// awsCredentials completes a resolved AWS Signature auth from the process
+// environment, and works out the service and region from an AWS host name
+// when they are still blank.
+func awsCredentials(a Auth, host string) (Auth, error) {
+	a = awsFromEnvironment(a)
+
+	// Such as execute-api.eu-west-1.amazonaws.com or s3.us-east-2.amazonaws.com
+	labels := strings.Split(strings.TrimSuffix(hostName(host), ".amazonaws.com"), ".")
+	if strings.HasSuffix(hostName(host), ".amazonaws.com") && len(labels) >= 2 {
+		if a.Service == "" {
+			a.Service = labels[len(labels)-2]
+		}
+		if a.Region == "" {
+			a.Region = labels[len(labels)-1]
+		}
+	}
+
+	switch {
+	case a.AccessKey == "" || a.SecretKey == "":
+		return a, fmt.Errorf("the access key and secret key are empty, and AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY aren't set")
+	case a.Region == "":
+		return a, fmt.Errorf("the region is empty, and AWS_REGION isn't set")
+	case a.Service == "":
+		return a, fmt.Errorf("the service is empty, such as execute-api or s3")
+	}
+	return a, nil
+}
+
+func hostName(host string) string {
+	if name, _, ok := strings.Cut(host, ":"); ok && !strings.Contains(name, "]") {
+		return name
+	}
+	return host
+}
+
+// signSigV4 signs req with AWS Signature Version 4, as described in
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html.
+// Every header already on the request is signed, save for ones that
+// proxies and the transport are known to change.
+func signSigV4(req *http.Request, a Auth) error {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	a, err := awsCredentials(a, host)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		payload, err = io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	payloadHash := sha256Hex(payload)
+
+	now := sigV4Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+	if a.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	headers := map[string][]string{"host": {host}}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		switch name {
+		case "authorization", "connection", "expect", "user-agent", "x-amzn-trace-id":
+			continue
+		}
+		headers[name] = append(headers[name], values...)
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		values := make([]string, len(headers[name]))
+		for i, value := range headers[name] {
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Path(req.URL, a.Service),
+		sigV4Query(req.URL.RawQuery),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.Region + "/" + a.Service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + a.SecretKey)
+	for _, part := range []string{date, a.Region, a.Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", a.AccessKey, scope, signedHeaders, signature))
+	return nil
+}
+
+// sigV4Path is the canonical URI of u: its path with each segment escaped
+// once. Other services than S3 also drop "." and ".." segments and repeated
+// slashes, while S3 signs object keys as they are.
+func sigV4Path(u *url.URL, service string) string {
+	p := u.Path
+	if p == "" {
+		return "/"
+	}
+	if service != "s3" {
+		cleaned := path.Clean(p)
+		if strings.HasSuffix(p, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+		p = cleaned
+	}
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = sigV4Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4Query sorts the params of a query string and escapes them the way
+// AWS does.
+func sigV4Query(rawQuery string) string {
+	var pairs []string
+	for _, kv := range parseQuery(rawQuery) {
+		pairs = append(pairs, sigV4Escape(kv.Key)+"="+sigV4Escape(kv.Value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything but the unreserved characters of
+// RFC 3986.
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
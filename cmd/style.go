@@ -34,11 +34,31 @@ var titleStyle = lipgloss.NewStyle().
 	Background(lipgloss.Color("62")).
 	Foreground(lipgloss.Color("230"))
 
+var keyStyle = lipgloss.NewStyle().
+	Foreground(green).
+	Bold(true)
+
+var failStyle = lipgloss.NewStyle().
+	Foreground(red).
+	Bold(true)
+
+var dynamicStyle = lipgloss.NewStyle().
+	Foreground(indigo).
+	Bold(true)
+
+var disabledStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("245")).
+	Strikethrough(true)
+
 var headingStyle = lipgloss.NewStyle().
 	Background(lipgloss.Color("11")).
 	Foreground(lipgloss.Color("0")).
 	MarginLeft(2)
 
+var timingStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("245")).
+	MarginLeft(2)
+
 func NewStyles(lg *lipgloss.Renderer) *Styles {
 	s := Styles{}
 	s.Base = lg.NewStyle().
@@ -89,6 +109,62 @@ var (
 	activeTabStyle   = inactiveTabStyle.Border(lipgloss.DoubleBorder(), false, false, true, false)
 )
 
+// tabRow renders tab labels with the active one underlined. When they don't
+// fit in width only the tabs around the active one are shown, with arrows
+// marking the hidden ones.
+func tabRow(labels []string, active, width int) string {
+	rendered := make([]string, len(labels))
+	for i, label := range labels {
+		style := inactiveTabStyle
+		if i == active {
+			style = activeTabStyle
+		}
+		rendered[i] = style.Render(label)
+	}
+
+	row := lipgloss.JoinHorizontal(lipgloss.Top, rendered...)
+	if lipgloss.Width(row) <= width || len(labels) == 0 {
+		return row
+	}
+
+	arrow := lipgloss.NewStyle().Foreground(green)
+	fits := func(from, to int) bool {
+		w := 0
+		for _, r := range rendered[from:to] {
+			w += lipgloss.Width(r)
+		}
+		if from > 0 {
+			w += 2
+		}
+		if to < len(rendered) {
+			w += 2
+		}
+		return w <= width
+	}
+
+	from, to := active, active+1
+	for grew := true; grew; {
+		grew = false
+		if to < len(rendered) && fits(from, to+1) {
+			to++
+			grew = true
+		}
+		if from > 0 && fits(from-1, to) {
+			from--
+			grew = true
+		}
+	}
+
+	parts := rendered[from:to]
+	if from > 0 {
+		parts = append([]string{arrow.Render("‹ ")}, parts...)
+	}
+	if to < len(rendered) {
+		parts = append(parts, arrow.Render(" ›"))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, parts...)
+}
+
 func (m help) appBoundaryView(text string) string {
 	return lipgloss.PlaceHorizontal(m.width, lipgloss.Left, m.styles.HeaderText.Render("+-- "+text), lipgloss.WithWhitespaceChars("/"), lipgloss.WithWhitespaceForeground(indigo))
 }
@@ -105,6 +181,14 @@ func (m board) appBoundaryMessage(text string) string {
 	return lipgloss.PlaceHorizontal(m.width, lipgloss.Left, m.styles.ErrorHeaderText.Render(text))
 }
 
+func (m historyBoard) appBoundaryMessage(text string) string {
+	return lipgloss.PlaceHorizontal(m.width, lipgloss.Left, m.styles.ErrorHeaderText.Render(text))
+}
+
+func (m envPicker) appBoundaryMessage(text string) string {
+	return lipgloss.PlaceHorizontal(m.width, lipgloss.Left, m.styles.ErrorHeaderText.Render(text))
+}
+
 func (m env) appBoundaryView(text string) string {
 	return lipgloss.PlaceHorizontal(m.width, lipgloss.Left, m.styles.HeaderText.Render("+-- "+text))
 }
@@ -112,3 +196,11 @@ func (m env) appBoundaryView(text string) string {
 func (m env) appBoundaryMessage(text string) string {
 	return lipgloss.PlaceHorizontal(m.width, lipgloss.Left, m.styles.ErrorHeaderText.Render(text))
 }
+
+func (m collectionRunner) appBoundaryView(text string) string {
+	return lipgloss.PlaceHorizontal(m.width, lipgloss.Left, m.styles.HeaderText.Render("+-- "+text))
+}
+
+func (m collectionRunner) appBoundaryMessage(text string) string {
+	return lipgloss.PlaceHorizontal(m.width, lipgloss.Left, m.styles.ErrorHeaderText.Render(text))
+}
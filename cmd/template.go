@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/google/uuid"
+)
+
+// placeholderRegexp matches the innermost {{key}}, so placeholders nested in
+// the arguments of a built-in are resolved first.
+var placeholderRegexp = regexp.MustCompile(`{{([^{}]*)}}`)
+
+// builtins are the dynamic {{$name args}} placeholders. They are evaluated
+// every time they are resolved, so two {{$uuid}} give two different values.
+var builtins = map[string]func(args string) (string, error){
+	"$uuid": func(args string) (string, error) {
+		return uuid.New().String(), noArgs("$uuid", args)
+	},
+	"$timestamp": func(args string) (string, error) {
+		return strconv.FormatInt(time.Now().Unix(), 10), noArgs("$timestamp", args)
+	},
+	"$isoTimestamp": func(args string) (string, error) {
+		return time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"), noArgs("$isoTimestamp", args)
+	},
+	"$randomInt": func(args string) (string, error) {
+		lo, hi := 0, 1000
+		if fields := strings.Fields(args); len(fields) > 0 {
+			if len(fields) != 2 {
+				return "", fmt.Errorf("$randomInt takes no arguments or a min and max, as in {{$randomInt 1 100}}")
+			}
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(fields[0])
+			hi, err2 = strconv.Atoi(fields[1])
+			if err1 != nil || err2 != nil || lo > hi {
+				return "", fmt.Errorf("$randomInt needs whole numbers with min <= max, got %q", args)
+			}
+		}
+		// The span is worked out unsigned, as hi-lo+1 overflows an int
+		// for ranges such as the whole of it
+		span := uint64(hi) - uint64(lo) + 1
+		n := rand.Uint64()
+		if span != 0 {
+			n = rand.Uint64N(span)
+		}
+		return strconv.Itoa(int(uint64(lo) + n)), nil
+	},
+	"$randomEmail": func(args string) (string, error) {
+		const letters = "abcdefghijklmnopqrstuvwxyz"
+		name := make([]byte, 10)
+		for i := range name {
+			name[i] = letters[rand.IntN(len(letters))]
+		}
+		return string(name) + "@example.com", noArgs("$randomEmail", args)
+	},
+	"$base64": func(args string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(args)), nil
+	},
+	"$env": func(args string) (string, error) {
+		name := strings.TrimSpace(args)
+		if name == "" {
+			return "", fmt.Errorf("$env needs a variable name, as in {{$env HOME}}")
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	},
+}
+
+func noArgs(name, args string) error {
+	if strings.TrimSpace(args) != "" {
+		return fmt.Errorf("%s takes no arguments", name)
+	}
+	return nil
+}
+
+// resolvePlaceholders replaces each {{key}} in text with its variable and
+// each {{$name args}} with the result of the built-in. Placeholders that
+// can't be resolved are left in place; the first built-in that fails, or
+// that doesn't exist, is returned as the error.
+//
+// Placeholders in a variable's value are resolved too, so one variable can
+// be built from others, but built-ins only run when they are typed in text:
+// a value such as a response extracted into a variable can't call $env.
+func resolvePlaceholders(text string, variables map[string]string) (string, error) {
+	var firstErr error
+	resolved, _ := resolveText(text, variables, false, 0, &firstErr)
+	return resolved, firstErr
+}
+
+// maxPlaceholderDepth caps how deep variables are resolved inside the values
+// of other variables, which stops ones that refer to themselves.
+const maxPlaceholderDepth = 4
+
+// resolveText resolves the placeholders of text, which is a variable's value
+// when inValue is set. It reports whether every placeholder was resolved.
+func resolveText(text string, variables map[string]string, inValue bool, depth int, firstErr *error) (string, bool) {
+	var b strings.Builder
+	complete := true
+	for {
+		start, end := nextPlaceholder(text)
+		if start < 0 {
+			b.WriteString(text)
+			return b.String(), complete
+		}
+		b.WriteString(text[:start])
+
+		// Placeholders nested in this one, such as the arguments of a
+		// built-in, are resolved first
+		key, ok := resolveText(text[start+2:end], variables, inValue, depth, firstErr)
+		value, resolved := resolveKey(key, ok, variables, inValue, depth, firstErr)
+		if !resolved {
+			value = "{{" + key + "}}"
+			complete = false
+		}
+		b.WriteString(value)
+		text = text[end+2:]
+	}
+}
+
+// nextPlaceholder finds the first {{ in text and its matching }}, returning
+// -1 when there is none. Extra opening braces before a placeholder, as in
+// {"id":{{{id}}}}, are left as text.
+func nextPlaceholder(text string) (int, int) {
+	start := strings.Index(text, "{{")
+	if start < 0 {
+		return -1, -1
+	}
+	for start+2 < len(text) && text[start+2] == '{' {
+		start++
+	}
+	open := 1
+	for i := start + 2; i+1 < len(text); i++ {
+		switch text[i : i+2] {
+		case "{{":
+			open++
+			i++
+		case "}}":
+			open--
+			if open == 0 {
+				return start, i
+			}
+			i++
+		}
+	}
+	return -1, -1
+}
+
+// resolveKey is the value of the placeholder {{key}}, whose own nested
+// placeholders were all resolved when complete is set.
+func resolveKey(key string, complete bool, variables map[string]string, inValue bool, depth int, firstErr *error) (string, bool) {
+	if !complete {
+		return "", false
+	}
+	if value, ok := variables[key]; ok {
+		if depth >= maxPlaceholderDepth {
+			return value, true
+		}
+		value, _ = resolveText(value, variables, true, depth+1, firstErr)
+		return value, true
+	}
+	if !strings.HasPrefix(key, "$") || inValue {
+		return "", false
+	}
+
+	name, args, _ := strings.Cut(key, " ")
+	fn, ok := builtins[name]
+	if !ok {
+		if *firstErr == nil {
+			*firstErr = fmt.Errorf("unknown function %s in {{%s}}", name, key)
+		}
+		return "", false
+	}
+	value, err := fn(args)
+	if err != nil {
+		if *firstErr == nil {
+			*firstErr = err
+		}
+		return "", false
+	}
+	return value, true
+}
+
+// replacePlaceholders is resolvePlaceholders for callers that can live with
+// placeholders that fail to resolve.
+func replacePlaceholders(text string, variables map[string]string) string {
+	resolved, _ := resolvePlaceholders(text, variables)
+	return resolved
+}
+
+// placeholder is a {{key}} found in a request, with what it resolves to.
+type placeholder struct {
+	key      string
+	value    string
+	resolved bool
+	// dynamic placeholders call a built-in when the request is sent
+	dynamic bool
+	// unknown is set for a built-in that doesn't exist
+	unknown bool
+}
+
+// findPlaceholders lists the distinct placeholders in texts in the order they
+// appear. Only the innermost placeholders are listed, as those are the ones
+// that need variables.
+func findPlaceholders(variables map[string]string, texts ...string) []placeholder {
+	var found []placeholder
+	seen := map[string]bool{}
+	for _, text := range texts {
+		for _, match := range placeholderRegexp.FindAllStringSubmatch(text, -1) {
+			key := match[1]
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			p := placeholder{key: key}
+			if value, ok := variables[key]; ok {
+				p.value, p.resolved = value, true
+			} else if strings.HasPrefix(key, "$") {
+				name, _, _ := strings.Cut(key, " ")
+				_, ok := builtins[name]
+				p.dynamic, p.unknown = true, !ok
+			}
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// unresolvedVariables names the placeholders in texts that have no variable.
+// Built-ins are left out since they fail on their own when they can't run.
+func unresolvedVariables(variables map[string]string, texts ...string) []string {
+	var names []string
+	for _, p := range findPlaceholders(variables, texts...) {
+		if !p.resolved && !p.dynamic {
+			names = append(names, p.key)
+		}
+	}
+	return names
+}
+
+// requestTexts returns the parts of r that placeholders are resolved in.
+func requestTexts(r Request) []string {
+	texts := append([]string{r.URL}, bodyTexts(r)...)
+	texts = append(texts, r.Headers.texts()...)
+	texts = append(texts, r.Auth.texts()...)
+	return append(texts, r.QueryParams.texts()...)
+}
+
+// placeholderList writes names as {{a}}, {{b}}.
+func placeholderList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "{{" + name + "}}"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// placeholderBar previews the placeholders being edited: a focused URL is
+// shown resolved, otherwise each placeholder is listed with its value.
+// Placeholders without a variable are shown in red.
+func placeholderBar(variables map[string]string, url string, urlFocused bool, texts ...string) string {
+	if urlFocused {
+		if !placeholderRegexp.MatchString(url) {
+			return ""
+		}
+		return "↳ " + placeholderRegexp.ReplaceAllStringFunc(url, func(match string) string {
+			p := findPlaceholders(variables, match)[0]
+			switch {
+			case p.resolved:
+				return p.value
+			case p.unknown:
+				return failStyle.Render(match)
+			case p.dynamic:
+				return dynamicStyle.Render(match)
+			}
+			return failStyle.Render(match)
+		})
+	}
+
+	// Placeholders that need attention come first, before they are cut off
+	found := findPlaceholders(variables, append([]string{url}, texts...)...)
+	sort.SliceStable(found, func(i, j int) bool {
+		return placeholderMissing(found[i]) && !placeholderMissing(found[j])
+	})
+
+	var parts []string
+	for _, p := range found {
+		name := "{{" + p.key + "}}"
+		switch {
+		case p.resolved:
+			parts = append(parts, keyStyle.Render(name)+" "+ansi.Truncate(p.value, 24, "…"))
+		case p.unknown:
+			parts = append(parts, failStyle.Render(name)+" unknown function")
+		case p.dynamic:
+			parts = append(parts, dynamicStyle.Render(name))
+		default:
+			parts = append(parts, failStyle.Render(name)+" unset")
+		}
+	}
+	return strings.Join(parts, "  ")
+}
+
+func placeholderMissing(p placeholder) bool {
+	return p.unknown || (!p.resolved && !p.dynamic)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestResolvePlaceholders(t *testing.T) {
+	t.Setenv("GOSTMAN_TEST_SECRET", "shh")
+	variables := map[string]string{
+		"host":     "example.com",
+		"baseUrl":  "https://{{host}}/v1",
+		"user":     "ada",
+		"password": "p{ss}",
+		"loop":     "{{loop}}",
+		"leak":     "{{$env GOSTMAN_TEST_SECRET}}",
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"{{baseUrl}}/users", "https://example.com/v1/users"},
+		{"{{missing}} and {{user}}", "{{missing}} and ada"},
+		{`{"id":{{{user}}}}`, `{"id":{ada}}`},
+		{"{{$base64 {{user}}:{{password}}}}", base64.StdEncoding.EncodeToString([]byte("ada:p{ss}"))},
+		{"{{$base64 {{missing}}}}", "{{$base64 {{missing}}}}"},
+		{"{{$env GOSTMAN_TEST_SECRET}}", "shh"},
+		{"{{loop}}", "{{loop}}"},
+		{"unclosed {{user", "unclosed {{user"},
+		// Built-ins in values are left as text
+		{"{{leak}}", "{{$env GOSTMAN_TEST_SECRET}}"},
+		{"{{$base64 {{leak}}}}", base64.StdEncoding.EncodeToString([]byte("{{$env GOSTMAN_TEST_SECRET}}"))},
+	}
+	for _, tt := range tests {
+		got, err := resolvePlaceholders(tt.text, variables)
+		if err != nil {
+			t.Errorf("resolvePlaceholders(%q) failed: %v", tt.text, err)
+		}
+		if got != tt.want {
+			t.Errorf("resolvePlaceholders(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	for _, text := range []string{"{{$nope}}", "{{$env GOSTMAN_TEST_UNSET}}", "{{$uuid {{user}}}}"} {
+		got, err := resolvePlaceholders(text, variables)
+		if err == nil {
+			t.Errorf("resolvePlaceholders(%q) = %q without an error", text, got)
+		}
+	}
+}
+
+func TestRandomInt(t *testing.T) {
+	randomInt := builtins["$randomInt"]
+	tests := []struct {
+		args   string
+		lo, hi int
+	}{
+		{"", 0, 1000},
+		{"5 5", 5, 5},
+		{"-3 3", -3, 3},
+		{strconv.Itoa(math.MinInt) + " " + strconv.Itoa(math.MaxInt), math.MinInt, math.MaxInt},
+		{strconv.Itoa(math.MaxInt-1) + " " + strconv.Itoa(math.MaxInt), math.MaxInt - 1, math.MaxInt},
+		{strconv.Itoa(math.MinInt) + " " + strconv.Itoa(math.MinInt+1), math.MinInt, math.MinInt + 1},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			value, err := randomInt(tt.args)
+			if err != nil {
+				t.Fatalf("$randomInt %s: %v", tt.args, err)
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < tt.lo || n > tt.hi {
+				t.Fatalf("$randomInt %s = %s", tt.args, value)
+			}
+		}
+	}
+
+	for _, args := range []string{"1", "2 1", "a b", "1 2 3"} {
+		if _, err := randomInt(args); err == nil {
+			t.Errorf("$randomInt %s succeeded", args)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timings records how long each phase of a request took. When redirects are
+// followed the connection phases of every hop are added together.
+type Timings struct {
+	DNS      time.Duration `json:"dns"`
+	Connect  time.Duration `json:"connect"`
+	TLS      time.Duration `json:"tls"`
+	TTFB     time.Duration `json:"ttfb"`
+	Download time.Duration `json:"download"`
+	Total    time.Duration `json:"total"`
+	Size     int64         `json:"size"`
+}
+
+// tracer collects Timings through the httptrace hooks of a request.
+type tracer struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	timings      Timings
+}
+
+func newTracer() *tracer {
+	return &tracer{start: time.Now()}
+}
+
+func (t *tracer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.DNS += time.Since(t.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.Connect += time.Since(t.connectStart)
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.TLS += time.Since(t.tlsStart)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = time.Now()
+			t.timings.TTFB = t.firstByte.Sub(t.wroteRequest)
+		},
+	}
+}
+
+// done finishes the measurement once the body has been read.
+func (t *tracer) done(size int64) *Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	end := time.Now()
+	if !t.firstByte.IsZero() {
+		t.timings.Download = end.Sub(t.firstByte)
+	}
+	t.timings.Total = end.Sub(t.start)
+	t.timings.Size = size
+
+	timings := t.timings
+	return &timings
+}
+
+// summary is the short form shown next to the response status.
+func (t Timings) summary() string {
+	return fmt.Sprintf("%s  %s", formatDuration(t.Total), formatBytes(t.Size))
+}
+
+// waterfall draws each phase as a bar positioned after the phases before it.
+func (t Timings) waterfall(width int) string {
+	phases := []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"DNS", t.DNS},
+		{"Connect", t.Connect},
+		{"TLS", t.TLS},
+		{"TTFB", t.TTFB},
+		{"Download", t.Download},
+	}
+
+	// name column, bar, and a duration column
+	barWidth := max(width-22, 10)
+
+	var b strings.Builder
+	var offset time.Duration
+	for _, p := range phases {
+		start, length := 0, 0
+		if t.Total > 0 {
+			start = int(float64(barWidth) * float64(offset) / float64(t.Total))
+			length = int(float64(barWidth) * float64(p.duration) / float64(t.Total))
+		}
+		if p.duration > 0 {
+			length = max(length, 1)
+		}
+		// Phases are timed apart from the total and can add up to more,
+		// so bars are kept within their column
+		length = min(length, barWidth)
+		start = max(min(start, barWidth-length), 0)
+		bar := strings.Repeat(" ", start) + strings.Repeat("█", length) + strings.Repeat(" ", barWidth-start-length)
+
+		b.WriteString(fmt.Sprintf("%-9s %s %10s\n", p.name, keyStyle.Render(bar), formatDuration(p.duration)))
+		offset += p.duration
+	}
+	b.WriteString(fmt.Sprintf("%-9s %s %10s\n", "Total", strings.Repeat(" ", barWidth), formatDuration(t.Total)))
+	b.WriteString(fmt.Sprintf("%-9s %s %10s\n", "Size", strings.Repeat(" ", barWidth), formatBytes(t.Size)))
+	return b.String()
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	default:
+		return fmt.Sprintf("%dµs", d.Microseconds())
+	}
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestWaterfallKeepsBarsInTheirColumn(t *testing.T) {
+	tests := []struct {
+		name    string
+		timings Timings
+	}{
+		{"phases within the total", Timings{DNS: 2 * time.Millisecond, Connect: 3 * time.Millisecond, TTFB: 10 * time.Millisecond, Download: 5 * time.Millisecond, Total: 20 * time.Millisecond}},
+		{"phases past the total", Timings{DNS: 40 * time.Millisecond, Connect: 30 * time.Millisecond, TLS: 50 * time.Millisecond, TTFB: 80 * time.Millisecond, Download: 20 * time.Millisecond, Total: 20 * time.Millisecond}},
+		{"one phase longer than the total", Timings{TTFB: time.Second, Total: time.Millisecond}},
+		{"no total", Timings{TTFB: time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, width := range []int{0, 30, 80} {
+				lines := strings.Split(strings.TrimSuffix(tt.timings.waterfall(width), "\n"), "\n")
+				want := lipgloss.Width(lines[len(lines)-1])
+				for _, line := range lines {
+					if w := lipgloss.Width(line); w != want {
+						t.Errorf("width %d: line %q is %d wide, want %d", width, line, w, want)
+					}
+				}
+			}
+		})
+	}
+}
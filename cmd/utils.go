@@ -1,8 +1,8 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
-	"os"
 	"regexp"
 	"strings"
 
@@ -13,8 +13,9 @@ import (
 )
 
 type responseMsg struct {
+	id       int
 	response string
-	status   string
+	result   result
 }
 
 type saveMsg struct {
@@ -73,59 +74,42 @@ func formatJSON(input string) string {
 	return string(prettyJSON)
 }
 
-func loadVariables() string {
-	var saved_data SavedData
+// loadSettings returns the global request settings.
+func loadSettings() Settings {
+	return getSavedData().Settings
+}
 
-	if !checkFileExists(jsonfilePath) {
-		file, err := os.ReadFile(jsonfilePath)
-		if err != nil {
-			panic(err)
-		}
-		json.Unmarshal(file, &saved_data)
+// indentJSON encodes v the way the editor tabs show JSON: indented, and
+// without escaping characters such as & that are common in URLs.
+func indentJSON(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return ""
 	}
-
-	return saved_data.Variables
+	return strings.TrimSuffix(buf.String(), "\n")
 }
 
-func createHeaders() string {
-
-	var rawData interface{}
-
-	headers := `
-	{
-		"Content-Type":"application/json",
-		"Accept":"*/*",
-		"Accept-Encoding":"gzip, deflate, br",
-		"Connection":"keep-alive"
-	}`
+// compressedEncodings is the Accept-Encoding of new requests, the one curl's
+// --compressed stands for.
+const compressedEncodings = "gzip, deflate, br"
 
-	err := json.Unmarshal([]byte(headers), &rawData)
-	if err != nil {
-		return headers
+// createHeaders returns the headers of a new request.
+func createHeaders() KeyValues {
+	return KeyValues{
+		{Key: "Accept", Value: "*/*"},
+		{Key: "Accept-Encoding", Value: compressedEncodings},
+		{Key: "Connection", Value: "keep-alive"},
 	}
-
-	prettyJSON, err := json.MarshalIndent(rawData, "", "  ")
-	if err != nil {
-		return headers
-	}
-
-	return string(prettyJSON)
-}
-
-func replacePlaceholders(url string, variables map[string]string) string {
-	re := regexp.MustCompile(`{{(.*?)}}`)
-	return re.ReplaceAllStringFunc(url, func(match string) string {
-		key := strings.Trim(match, "{}") // Extract key name
-		if value, exists := variables[key]; exists {
-			return value
-		}
-		return match // Keep original placeholder if key not found
-	})
 }
 
 type keymap struct {
 	Create key.Binding
 	Delete key.Binding
+	Import key.Binding
+	Run    key.Binding
 	Back   key.Binding
 	Quit   key.Binding
 }
@@ -140,6 +124,14 @@ var Keymap = keymap{
 		key.WithKeys("d"),
 		key.WithHelp("d", "delete"),
 	),
+	Import: key.NewBinding(
+		key.WithKeys("i"),
+		key.WithHelp("i", "import curl"),
+	),
+	Run: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("r", "run shown"),
+	),
 	Back: key.NewBinding(
 		key.WithKeys("esc"),
 		key.WithHelp("esc", "back"),
@@ -2,12 +2,17 @@ package main
 
 import (
 	"log"
+	"os"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/halftoothed/gostman/cmd"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(cmd.Execute(os.Args[1:]))
+	}
+
 	p := tea.NewProgram(cmd.NewModel(),
 		tea.WithAltScreen(),
 		tea.WithMouseCellMotion(),